@@ -6,9 +6,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+
+	"github.com/segersniels/convit/generate"
 )
 
-var _ MessageClient = (*Anthropic)(nil)
+var _ generate.StructuredClient = (*Anthropic)(nil)
 
 type ClaudeMessage struct {
 	Role    string `json:"role"`
@@ -25,6 +28,8 @@ type ClaudeMessagesRequest struct {
 type ClaudeMessagesResponseContent struct {
 	Text string `json:"text"`
 	Type string `json:"type"`
+	// The arguments of a tool call, only set for `tool_use` content
+	Input json.RawMessage `json:"input,omitempty"`
 }
 
 type ClaudeMessagesResponseUsage struct {
@@ -40,58 +45,162 @@ type ClaudeMessagesResponse struct {
 	Usage   ClaudeMessagesResponseUsage     `json:"usage"`
 }
 
+func (r *ClaudeMessagesResponse) usage() generate.Usage {
+	return generate.Usage{InputTokens: r.Usage.InputTokens, OutputTokens: r.Usage.OutputTokens}
+}
+
+type ClaudeErrorResponse struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+const AnthropicBaseURL = "https://api.anthropic.com/v1"
+
 type Anthropic struct {
-	apiKey string
-	model  string
+	apiKey  string
+	model   string
+	params  ModelParameters
+	baseURL string
+	client  *http.Client
 }
 
-func NewAnthropic(apiKey, model string) *Anthropic {
+func NewAnthropic(apiKey, model string, params ModelParameters, baseURL string, client *http.Client) *Anthropic {
+	if baseURL == "" {
+		baseURL = AnthropicBaseURL
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if params.MaxTokens <= 0 {
+		params.MaxTokens = DefaultMaxTokens
+	}
+
 	return &Anthropic{
 		apiKey,
 		model,
+		params,
+		strings.TrimSuffix(baseURL, "/"),
+		client,
 	}
 }
 
-func (a *Anthropic) CreateMessage(ctx context.Context, system string, prompt string) (string, error) {
-	body, err := json.Marshal(map[string]interface{}{
-		"model":      a.model,
-		"max_tokens": 4096,
-		"system":     system,
-		"messages": []ClaudeMessage{
-			{
-				Role:    MessageRoleUser,
-				Content: prompt,
-			},
-		},
-	})
+// Send a request to the messages API, along with the configured parameters
+func (a *Anthropic) send(ctx context.Context, payload map[string]interface{}) (*ClaudeMessagesResponse, error) {
+	if a.params.Temperature != nil {
+		payload["temperature"] = *a.params.Temperature
+	}
+
+	if a.params.TopP != nil {
+		payload["top_p"] = *a.params.TopP
+	}
+
+	if len(a.params.Stop) > 0 {
+		payload["stop_sequences"] = a.params.Stop
+	}
 
+	body, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("error marshaling JSON payload: %v", err)
+		return nil, fmt.Errorf("error marshaling JSON payload: %v", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.anthropic.com/v1/messages", bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/messages", bytes.NewBuffer(body))
 	if err != nil {
-		return "", fmt.Errorf("error creating request: %v", err)
+		return nil, fmt.Errorf("error creating request: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("x-api-key", a.apiKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := a.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error sending request: %v", err)
+		return nil, newProviderError(0, fmt.Errorf("error sending request: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		// Include the error message returned by the API when there is one
+		var failure ClaudeErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&failure); err == nil && failure.Error.Message != "" {
+			return nil, newProviderError(resp.StatusCode, fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, failure.Error.Message))
+		}
+
+		return nil, newProviderError(resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode))
 	}
 
 	var data ClaudeMessagesResponse
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return "", fmt.Errorf("error decoding response: %v", err)
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+
+	return &data, nil
+}
+
+func (a *Anthropic) CreateMessage(ctx context.Context, system string, prompt string) (string, generate.Usage, error) {
+	data, err := a.send(ctx, map[string]interface{}{
+		"model":      a.model,
+		"max_tokens": a.params.MaxTokens,
+		"system":     system,
+		"messages": []ClaudeMessage{
+			{
+				Role:    MessageRoleUser,
+				Content: prompt,
+			},
+		},
+	})
+
+	if err != nil {
+		return "", generate.Usage{}, err
+	}
+
+	usage := data.usage()
+	if len(data.Content) == 0 {
+		return "", usage, nil
+	}
+
+	return data.Content[0].Text, usage, nil
+}
+
+// Force the model to call a tool whose input follows the schema, returning the input as JSON
+func (a *Anthropic) CreateStructuredMessage(ctx context.Context, system string, prompt string, schema generate.Schema) (string, generate.Usage, error) {
+	data, err := a.send(ctx, map[string]interface{}{
+		"model":      a.model,
+		"max_tokens": a.params.MaxTokens,
+		"system":     system,
+		"messages": []ClaudeMessage{
+			{
+				Role:    MessageRoleUser,
+				Content: prompt,
+			},
+		},
+		"tools": []map[string]interface{}{
+			{
+				"name":         generate.StructuredOutputName,
+				"description":  "Record the generated conventional commit message",
+				"input_schema": schema,
+			},
+		},
+		"tool_choice": map[string]string{
+			"type": "tool",
+			"name": generate.StructuredOutputName,
+		},
+	})
+
+	if err != nil {
+		return "", generate.Usage{}, err
+	}
+
+	usage := data.usage()
+	for _, content := range data.Content {
+		if content.Type == "tool_use" {
+			return string(content.Input), usage, nil
+		}
 	}
 
-	return data.Content[0].Text, nil
+	return "", usage, nil
 }
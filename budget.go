@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/segersniels/convit/generate"
+)
+
+// Caps on the tokens and estimated cost spent on generations, unset caps are not enforced
+type Budget struct {
+	DailyTokens   int     `json:"daily_tokens"`
+	MonthlyTokens int     `json:"monthly_tokens"`
+	DailyCost     float64 `json:"daily_cost"`
+	MonthlyCost   float64 `json:"monthly_cost"`
+	// The maximum amount of input tokens of a single request
+	MaxInputTokens int `json:"max_input_tokens"`
+	// Refuse to send requests that go over a cap instead of only warning about them
+	Refuse bool `json:"refuse"`
+}
+
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+func (b Budget) enabled() bool {
+	return b.DailyTokens > 0 || b.MonthlyTokens > 0 || b.DailyCost > 0 || b.MonthlyCost > 0 || b.MaxInputTokens > 0
+}
+
+// Check whether sending a request with the estimated amount of input tokens to the model would go over
+// one of the caps, based on the usage recorded in the ledger
+func checkBudget(model string, input int) error {
+	budget := CONFIG.Data.Budget
+	if !budget.enabled() {
+		return nil
+	}
+
+	exceeded := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s, use `convit generate --offline` or a cheaper model instead", ErrBudgetExceeded, fmt.Sprintf(format, args...))
+	}
+
+	if budget.MaxInputTokens > 0 && input > budget.MaxInputTokens {
+		return exceeded("the request is about %d input tokens while at most %d are allowed", input, budget.MaxInputTokens)
+	}
+
+	entries, err := loadUsage()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	// The output of the request is unknown up front, so only its input is taken into account
+	var dailyTokens, monthlyTokens int
+	var dailyCost, monthlyCost float64
+	for _, entry := range entries {
+		if entry.Time.Before(month) {
+			continue
+		}
+
+		monthlyTokens += entry.InputTokens + entry.OutputTokens
+		monthlyCost += entry.Cost
+
+		if !entry.Time.Before(today) {
+			dailyTokens += entry.InputTokens + entry.OutputTokens
+			dailyCost += entry.Cost
+		}
+	}
+
+	cost := usageCost(model, generate.Usage{InputTokens: input})
+
+	switch {
+	case budget.DailyTokens > 0 && dailyTokens+input > budget.DailyTokens:
+		return exceeded("%d of the daily %d tokens are used", dailyTokens, budget.DailyTokens)
+	case budget.MonthlyTokens > 0 && monthlyTokens+input > budget.MonthlyTokens:
+		return exceeded("%d of the monthly %d tokens are used", monthlyTokens, budget.MonthlyTokens)
+	case budget.DailyCost > 0 && dailyCost+cost > budget.DailyCost:
+		return exceeded("$%.4f of the daily $%.2f is spent", dailyCost, budget.DailyCost)
+	case budget.MonthlyCost > 0 && monthlyCost+cost > budget.MonthlyCost:
+		return exceeded("$%.4f of the monthly $%.2f is spent", monthlyCost, budget.MonthlyCost)
+	}
+
+	return nil
+}
+
+// Only warn once about going over the budget, even when several requests are made
+var budgetWarning sync.Once
+
+// Check the budget before sending a request to the model, refusing it when configured to or warning about it otherwise
+func enforceBudget(model, system, prompt string) error {
+	err := checkBudget(model, generate.EstimateTokens(system)+generate.EstimateTokens(prompt))
+	if err == nil {
+		return nil
+	}
+
+	// Don't get in the way when the ledger can't be read
+	if !errors.Is(err, ErrBudgetExceeded) {
+		log.Debug("Failed to check budget", "error", err)
+		return nil
+	}
+
+	if CONFIG.Data.Budget.Refuse {
+		return newBudgetError(err)
+	}
+
+	budgetWarning.Do(func() {
+		log.Warn(err.Error())
+	})
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// Fill the ledger with usage from last month, earlier this month and today. The tokens and cost
+// that count towards the daily and monthly caps are returned.
+func budgetLedger(t *testing.T) (daily, monthly int, dailyCost, monthlyCost float64) {
+	t.Helper()
+
+	testHome(t)
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	entries := []UsageEntry{
+		// Right before the start of the month, never counted
+		{Time: month.Add(-time.Second), Model: GPT4oMini, InputTokens: 9000, OutputTokens: 1000, Cost: 5},
+		{Time: today, Model: GPT4oMini, InputTokens: 80, OutputTokens: 20, Cost: 0.01},
+		{Time: now, Model: GPT4oMini, InputTokens: 40, OutputTokens: 10, Cost: 0.02},
+	}
+
+	daily, dailyCost = 150, 0.03
+
+	// Only possible when today isn't the first day of the month
+	if today.After(month) {
+		entries = append(entries, UsageEntry{Time: month, Model: GPT4oMini, InputTokens: 400, OutputTokens: 100, Cost: 0.5})
+		monthly, monthlyCost = daily+500, dailyCost+0.5
+	} else {
+		monthly, monthlyCost = daily, dailyCost
+	}
+
+	for _, entry := range entries {
+		if err := appendUsage(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return daily, monthly, dailyCost, monthlyCost
+}
+
+func TestCheckBudget(t *testing.T) {
+	daily, monthly, dailyCost, monthlyCost := budgetLedger(t)
+
+	// A model that costs $1 per 1000 input tokens keeps the cost checks simple
+	prices := map[string]Price{"priced": {Input: 1000}}
+
+	tests := []struct {
+		name     string
+		budget   Budget
+		input    int
+		exceeded bool
+	}{
+		{"disabled", Budget{}, 1_000_000, false},
+		{"request within the max input tokens", Budget{MaxInputTokens: 100}, 100, false},
+		{"request over the max input tokens", Budget{MaxInputTokens: 100}, 101, true},
+		{"within the daily tokens", Budget{DailyTokens: daily + 50}, 50, false},
+		{"over the daily tokens", Budget{DailyTokens: daily + 50}, 51, true},
+		{"within the monthly tokens", Budget{MonthlyTokens: monthly + 50}, 50, false},
+		{"over the monthly tokens", Budget{MonthlyTokens: monthly + 50}, 51, true},
+		{"within the daily cost", Budget{DailyCost: dailyCost + 0.05}, 40, false},
+		{"over the daily cost", Budget{DailyCost: dailyCost + 0.05}, 60, true},
+		{"within the monthly cost", Budget{MonthlyCost: monthlyCost + 0.05}, 40, false},
+		{"over the monthly cost", Budget{MonthlyCost: monthlyCost + 0.05}, 60, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, ConfigData{Budget: tt.budget, Prices: prices})
+
+			err := checkBudget("priced", tt.input)
+			if got := errors.Is(err, ErrBudgetExceeded); got != tt.exceeded {
+				t.Errorf("checkBudget(%d) = %v, want exceeded %v", tt.input, err, tt.exceeded)
+			}
+		})
+	}
+}
+
+func TestEnforceBudget(t *testing.T) {
+	daily, _, _, _ := budgetLedger(t)
+
+	// Over the budget without refusing only warns
+	useConfig(t, ConfigData{Budget: Budget{DailyTokens: daily}})
+	if err := enforceBudget(GPT4oMini, "system", "prompt"); err != nil {
+		t.Errorf("enforceBudget() = %v, want only a warning", err)
+	}
+
+	useConfig(t, ConfigData{Budget: Budget{DailyTokens: daily, Refuse: true}})
+
+	err := enforceBudget(GPT4oMini, "system", "prompt")
+
+	var exitErr *ExitCodeError
+	if !errors.As(err, &exitErr) || exitErr.Code != ExitCodeBudget || !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("enforceBudget() = %v, want a budget error", err)
+	}
+
+	// Within the budget the request goes through
+	useConfig(t, ConfigData{Budget: Budget{DailyTokens: daily + 100, Refuse: true}})
+	if err := enforceBudget(GPT4oMini, "system", "prompt"); err != nil {
+		t.Errorf("enforceBudget() = %v, want no error", err)
+	}
+}
+
+func TestEnforceBudgetUnreadableLedger(t *testing.T) {
+	testHome(t)
+	useConfig(t, ConfigData{Budget: Budget{DailyTokens: 1, Refuse: true}})
+
+	// A directory where the ledger should be can't be read, which shouldn't block requests
+	path, err := usageLedgerPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := enforceBudget(GPT4oMini, "", ""); err != nil {
+		t.Errorf("enforceBudget() = %v, want no error", err)
+	}
+}
@@ -0,0 +1,215 @@
+// Package conventional parses, formats and validates commit messages following the
+// Conventional Commits specification (https://www.conventionalcommits.org/en/v1.0.0/).
+package conventional
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// The footer token that marks a commit as introducing a breaking change
+	BreakingChange = "BREAKING CHANGE"
+	// Synonym of BreakingChange that is allowed by the specification
+	BreakingChangeHyphen = "BREAKING-CHANGE"
+)
+
+var (
+	ErrEmptyMessage     = errors.New("commit message is empty")
+	ErrInvalidHeader    = errors.New("commit header must be in the form `type(scope)!: description`")
+	ErrMissingBlankLine = errors.New("commit body must begin one blank line after the description")
+	ErrEmptyDescription = errors.New("commit description cannot be empty")
+)
+
+var (
+	// Matches `type(scope)!: description`
+	headerPattern = regexp.MustCompile(`^([A-Za-z][\w-]*)(?:\(([^()\r\n]+)\))?(!)?: (.*)$`)
+	// Matches `token: value` and `token #value`
+	footerPattern = regexp.MustCompile(`^(BREAKING CHANGE|BREAKING-CHANGE|[\w-]+)(: | #)(.*)$`)
+)
+
+// A single git trailer style footer, eg. `Refs: #123` or `BREAKING CHANGE: drops support for Go 1.20`
+type Footer struct {
+	Token string
+	// Either `: ` or ` #`, defaults to `: ` when empty
+	Separator string
+	Value     string
+}
+
+func (f Footer) String() string {
+	separator := f.Separator
+	if separator == "" {
+		separator = ": "
+	}
+
+	return f.Token + separator + f.Value
+}
+
+// Whether the footer describes a breaking change
+func (f Footer) IsBreakingChange() bool {
+	return f.Token == BreakingChange || f.Token == BreakingChangeHyphen
+}
+
+// A parsed conventional commit message
+type Commit struct {
+	Type  string
+	Scope string
+	// Whether the commit introduces a breaking change, either through `!` in the header or a breaking change footer
+	Breaking bool
+	// Whether the header marks the breaking change with `!`
+	BreakingMarker bool
+	Description    string
+	Body           string
+	Footers        []Footer
+}
+
+// Parse a commit message according to the Conventional Commits specification
+func Parse(message string) (*Commit, error) {
+	message = strings.TrimRight(strings.ReplaceAll(message, "\r\n", "\n"), " \t\n")
+	if strings.TrimSpace(message) == "" {
+		return nil, ErrEmptyMessage
+	}
+
+	lines := strings.Split(message, "\n")
+
+	match := headerPattern.FindStringSubmatch(lines[0])
+	if match == nil {
+		return nil, ErrInvalidHeader
+	}
+
+	commit := &Commit{
+		Type:           match[1],
+		Scope:          match[2],
+		Breaking:       match[3] == "!",
+		BreakingMarker: match[3] == "!",
+		Description:    strings.TrimSpace(match[4]),
+	}
+
+	if commit.Description == "" {
+		return nil, ErrEmptyDescription
+	}
+
+	rest := lines[1:]
+	if len(rest) == 0 {
+		return commit, nil
+	}
+
+	if strings.TrimSpace(rest[0]) != "" {
+		return nil, ErrMissingBlankLine
+	}
+
+	start := footerStart(rest)
+	commit.Body = strings.TrimSpace(strings.Join(rest[:start], "\n"))
+	commit.Footers = parseFooters(rest[start:])
+
+	for _, footer := range commit.Footers {
+		if footer.IsBreakingChange() {
+			commit.Breaking = true
+		}
+	}
+
+	return commit, nil
+}
+
+// Find the line at which the footers start, being the first paragraph from which every
+// following paragraph starts with a footer. Returns the amount of lines when there are no footers.
+func footerStart(lines []string) int {
+	start := len(lines)
+	for i := len(lines) - 1; i > 0; i-- {
+		// Only the first line of a paragraph can start the footers
+		if strings.TrimSpace(lines[i-1]) != "" {
+			continue
+		}
+
+		if !footerPattern.MatchString(lines[i]) {
+			// A paragraph that isn't a footer means everything before it is part of the body
+			if strings.TrimSpace(lines[i]) != "" {
+				break
+			}
+
+			continue
+		}
+
+		start = i
+	}
+
+	return start
+}
+
+func parseFooters(lines []string) []Footer {
+	var footers []Footer
+	for _, line := range lines {
+		if match := footerPattern.FindStringSubmatch(line); match != nil {
+			footers = append(footers, Footer{Token: match[1], Separator: match[2], Value: match[3]})
+			continue
+		}
+
+		// Any other line continues the value of the previous footer
+		if len(footers) > 0 {
+			footers[len(footers)-1].Value += "\n" + line
+		}
+	}
+
+	for i := range footers {
+		footers[i].Value = strings.TrimSpace(footers[i].Value)
+	}
+
+	return footers
+}
+
+// The first line of the commit message, eg. `feat(parser)!: add ability to parse arrays`
+func (c Commit) Header() string {
+	var b strings.Builder
+	b.WriteString(c.Type)
+
+	if c.Scope != "" {
+		fmt.Fprintf(&b, "(%s)", c.Scope)
+	}
+
+	if c.BreakingMarker || (c.Breaking && !c.hasBreakingChangeFooter()) {
+		b.WriteString("!")
+	}
+
+	b.WriteString(": " + c.Description)
+
+	return b.String()
+}
+
+func (c Commit) hasBreakingChangeFooter() bool {
+	for _, footer := range c.Footers {
+		if footer.IsBreakingChange() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Format the full commit message. Breaking changes are marked with `!` in the header when they were
+// parsed that way or when there is no breaking change footer describing them.
+func (c Commit) String() string {
+	parts := []string{c.Header()}
+	if c.Body != "" {
+		parts = append(parts, c.Body)
+	}
+
+	if len(c.Footers) > 0 {
+		footers := make([]string, 0, len(c.Footers))
+		for _, footer := range c.Footers {
+			footers = append(footers, footer.String())
+		}
+
+		parts = append(parts, strings.Join(footers, "\n"))
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+// Whether the message is a valid conventional commit
+func IsConventional(message string) bool {
+	_, err := Parse(message)
+
+	return err == nil
+}
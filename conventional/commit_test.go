@@ -0,0 +1,297 @@
+package conventional
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// The examples of the specification (https://www.conventionalcommits.org/en/v1.0.0/#examples)
+var specExamples = []struct {
+	name    string
+	message string
+	commit  Commit
+}{
+	{
+		name:    "description and breaking change footer",
+		message: "feat: allow provided config object to extend other configs\n\nBREAKING CHANGE: `extends` key in config file is now used for extending other config files",
+		commit: Commit{
+			Type:        "feat",
+			Breaking:    true,
+			Description: "allow provided config object to extend other configs",
+			Footers:     []Footer{{BreakingChange, ": ", "`extends` key in config file is now used for extending other config files"}},
+		},
+	},
+	{
+		name:    "! to draw attention to breaking change",
+		message: "feat!: send an email to the customer when a product is shipped",
+		commit: Commit{
+			Type:           "feat",
+			Breaking:       true,
+			BreakingMarker: true,
+			Description:    "send an email to the customer when a product is shipped",
+		},
+	},
+	{
+		name:    "scope and ! to draw attention to breaking change",
+		message: "feat(api)!: send an email to the customer when a product is shipped",
+		commit: Commit{
+			Type:           "feat",
+			Scope:          "api",
+			Breaking:       true,
+			BreakingMarker: true,
+			Description:    "send an email to the customer when a product is shipped",
+		},
+	},
+	{
+		name:    "both ! and breaking change footer",
+		message: "chore!: drop support for Node 6\n\nBREAKING CHANGE: use JavaScript features not available in Node 6.",
+		commit: Commit{
+			Type:           "chore",
+			Breaking:       true,
+			BreakingMarker: true,
+			Description:    "drop support for Node 6",
+			Footers:        []Footer{{BreakingChange, ": ", "use JavaScript features not available in Node 6."}},
+		},
+	},
+	{
+		name:    "no body",
+		message: "docs: correct spelling of CHANGELOG",
+		commit:  Commit{Type: "docs", Description: "correct spelling of CHANGELOG"},
+	},
+	{
+		name:    "scope",
+		message: "feat(lang): add Polish language",
+		commit:  Commit{Type: "feat", Scope: "lang", Description: "add Polish language"},
+	},
+	{
+		name: "multi-paragraph body and multiple footers",
+		message: "fix: prevent racing of requests\n\n" +
+			"Introduce a request id and a reference to latest request. Dismiss\nincoming responses other than from latest request.\n\n" +
+			"Remove timeouts which were used to mitigate the racing issue but are\nobsolete now.\n\n" +
+			"Reviewed-by: Z\nRefs: #123",
+		commit: Commit{
+			Type:        "fix",
+			Description: "prevent racing of requests",
+			Body: "Introduce a request id and a reference to latest request. Dismiss\nincoming responses other than from latest request.\n\n" +
+				"Remove timeouts which were used to mitigate the racing issue but are\nobsolete now.",
+			Footers: []Footer{{"Reviewed-by", ": ", "Z"}, {"Refs", ": ", "#123"}},
+		},
+	},
+}
+
+func TestParseSpecExamples(t *testing.T) {
+	for _, tt := range specExamples {
+		t.Run(tt.name, func(t *testing.T) {
+			commit, err := Parse(tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(*commit, tt.commit) {
+				t.Errorf("Parse() = %#v, want %#v", *commit, tt.commit)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	messages := []string{
+		"feat: x\n\nBREAKING CHANGE: y",
+		"feat!: x\n\nBREAKING CHANGE: y",
+		"feat(api)!: x",
+		"fix: x\n\nBREAKING-CHANGE: y",
+		"fix: x\n\nbody\n\nRefs #123\nReviewed-by: Z",
+		"refactor!: drop the old parser\n\nThe old parser was deprecated a year ago.",
+	}
+
+	for _, tt := range specExamples {
+		messages = append(messages, tt.message)
+	}
+
+	for _, message := range messages {
+		commit, err := Parse(message)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", message, err)
+			continue
+		}
+
+		if got := commit.String(); got != message {
+			t.Errorf("Parse(%q).String() = %q", message, got)
+		}
+	}
+}
+
+func TestParseFooters(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		body     string
+		footers  []Footer
+		breaking bool
+	}{
+		{
+			name:    "hash separator",
+			message: "fix: x\n\nCloses #42",
+			footers: []Footer{{"Closes", " #", "42"}},
+		},
+		{
+			name:     "hyphenated breaking change",
+			message:  "fix: x\n\nBREAKING-CHANGE: the config moved",
+			footers:  []Footer{{BreakingChangeHyphen, ": ", "the config moved"}},
+			breaking: true,
+		},
+		{
+			name:     "multi-line value",
+			message:  "fix: x\n\nBREAKING CHANGE: the config moved\n  to a new location\nRefs: #1",
+			footers:  []Footer{{BreakingChange, ": ", "the config moved\n  to a new location"}, {"Refs", ": ", "#1"}},
+			breaking: true,
+		},
+		{
+			name:    "lowercase breaking change is a regular footer",
+			message: "fix: x\n\nbreaking-change: nope",
+			footers: []Footer{{"breaking-change", ": ", "nope"}},
+		},
+		{
+			name:    "footer-like paragraph followed by body",
+			message: "fix: x\n\nNote: this is part of the body\n\nsince this paragraph isn't a footer",
+			body:    "Note: this is part of the body\n\nsince this paragraph isn't a footer",
+		},
+		{
+			name:    "token with spaces is not a footer",
+			message: "fix: x\n\nSee also: the docs",
+			body:    "See also: the docs",
+		},
+		{
+			name:    "body followed by footers",
+			message: "fix: x\n\nSome context.\n\nAcked-by: A\nRefs: #2",
+			body:    "Some context.",
+			footers: []Footer{{"Acked-by", ": ", "A"}, {"Refs", ": ", "#2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commit, err := Parse(tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if commit.Body != tt.body {
+				t.Errorf("body = %q, want %q", commit.Body, tt.body)
+			}
+
+			if !reflect.DeepEqual(commit.Footers, tt.footers) {
+				t.Errorf("footers = %#v, want %#v", commit.Footers, tt.footers)
+			}
+
+			if commit.Breaking != tt.breaking {
+				t.Errorf("breaking = %v, want %v", commit.Breaking, tt.breaking)
+			}
+
+			if commit.BreakingMarker {
+				t.Error("breaking marker should only be set by `!`")
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		message string
+		err     error
+	}{
+		{"", ErrEmptyMessage},
+		{" \n\t\n", ErrEmptyMessage},
+		{"add a feature", ErrInvalidHeader},
+		{"feat:add a feature", ErrInvalidHeader},
+		{"feat : add a feature", ErrInvalidHeader},
+		{"feat(): add a feature", ErrInvalidHeader},
+		{"feat(a)(b): add a feature", ErrInvalidHeader},
+		{"1feat: add a feature", ErrInvalidHeader},
+		{"feat!!: add a feature", ErrInvalidHeader},
+		{"feat: ", ErrInvalidHeader},
+		{"feat:    \n\nbody", ErrEmptyDescription},
+		{"feat: add a feature\nbody right after the header", ErrMissingBlankLine},
+		{"feat: add a feature\nRefs: #1", ErrMissingBlankLine},
+	}
+
+	for _, tt := range tests {
+		if _, err := Parse(tt.message); !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.message, err, tt.err)
+		}
+
+		if IsConventional(tt.message) {
+			t.Errorf("IsConventional(%q) = true", tt.message)
+		}
+	}
+}
+
+func TestParseBlankLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		body    string
+	}{
+		{"trailing newlines", "fix: x\n\n\n", ""},
+		{"windows line endings", "fix: x\r\n\r\nbody\r\nmore", "body\nmore"},
+		{"several blank lines before the body", "fix: x\n\n\n\nbody", "body"},
+		{"blank lines within the body are kept", "fix: x\n\nfirst\n\n\nsecond", "first\n\n\nsecond"},
+		{"whitespace only separator line", "fix: x\n \nbody", "body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commit, err := Parse(tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if commit.Body != tt.body {
+				t.Errorf("body = %q, want %q", commit.Body, tt.body)
+			}
+		})
+	}
+}
+
+func TestCommitString(t *testing.T) {
+	tests := []struct {
+		name   string
+		commit Commit
+		want   string
+	}{
+		{
+			name:   "breaking change without footer is marked with !",
+			commit: Commit{Type: "feat", Breaking: true, Description: "x"},
+			want:   "feat!: x",
+		},
+		{
+			name:   "breaking change footer is enough",
+			commit: Commit{Type: "feat", Breaking: true, Description: "x", Footers: []Footer{{Token: BreakingChange, Value: "y"}}},
+			want:   "feat: x\n\nBREAKING CHANGE: y",
+		},
+		{
+			name:   "explicit marker is kept",
+			commit: Commit{Type: "feat", Scope: "api", Breaking: true, BreakingMarker: true, Description: "x", Footers: []Footer{{Token: BreakingChange, Value: "y"}}},
+			want:   "feat(api)!: x\n\nBREAKING CHANGE: y",
+		},
+		{
+			name:   "body without footers",
+			commit: Commit{Type: "fix", Description: "x", Body: "body"},
+			want:   "fix: x\n\nbody",
+		},
+		{
+			name:   "footers without body",
+			commit: Commit{Type: "fix", Description: "x", Footers: []Footer{{Token: "Refs", Separator: " #", Value: "1"}, {Token: "Acked-by", Value: "A"}}},
+			want:   "fix: x\n\nRefs #1\nAcked-by: A",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.commit.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
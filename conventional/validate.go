@@ -0,0 +1,81 @@
+package conventional
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrUnknownType   = errors.New("unknown commit type")
+	ErrUnknownScope  = errors.New("unknown commit scope")
+	ErrMissingScope  = errors.New("commit scope is required")
+	ErrHeaderTooLong = errors.New("commit header is too long")
+)
+
+// The types defined by the specification and the Angular convention it is based on
+var DefaultTypes = []string{"build", "chore", "ci", "docs", "feat", "fix", "perf", "refactor", "revert", "style", "test"}
+
+// Validates commits against a configurable set of rules
+type Validator struct {
+	// The allowed types, any type is allowed when empty
+	Types []string
+	// The allowed scopes, any scope is allowed when empty
+	Scopes []string
+	// Whether every commit needs a scope
+	RequireScope bool
+	// The maximum length of the header, no limit when zero
+	MaxHeaderLength int
+}
+
+// Create a validator that only allows the provided types
+func NewValidator(types ...string) *Validator {
+	return &Validator{Types: types}
+}
+
+// Check whether the commit follows the rules of the validator.
+// Types and scopes are compared case insensitively, as required by the specification.
+func (v *Validator) Validate(commit *Commit) error {
+	if commit.Description == "" {
+		return ErrEmptyDescription
+	}
+
+	if len(v.Types) > 0 && !containsFold(v.Types, commit.Type) {
+		return fmt.Errorf("%w %q, expected one of %s", ErrUnknownType, commit.Type, strings.Join(v.Types, ", "))
+	}
+
+	if commit.Scope == "" {
+		if v.RequireScope {
+			return ErrMissingScope
+		}
+	} else if len(v.Scopes) > 0 && !containsFold(v.Scopes, commit.Scope) {
+		return fmt.Errorf("%w %q, expected one of %s", ErrUnknownScope, commit.Scope, strings.Join(v.Scopes, ", "))
+	}
+
+	if v.MaxHeaderLength > 0 && len(commit.Header()) > v.MaxHeaderLength {
+		return fmt.Errorf("%w, %d characters exceeds the maximum of %d", ErrHeaderTooLong, len(commit.Header()), v.MaxHeaderLength)
+	}
+
+	return nil
+}
+
+// Parse the message and validate the resulting commit
+func (v *Validator) ValidateMessage(message string) (*Commit, error) {
+	commit, err := Parse(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.Validate(commit); err != nil {
+		return nil, err
+	}
+
+	return commit, nil
+}
+
+func containsFold(values []string, value string) bool {
+	return slices.ContainsFunc(values, func(v string) bool {
+		return strings.EqualFold(v, value)
+	})
+}
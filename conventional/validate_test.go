@@ -0,0 +1,54 @@
+package conventional
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		validator Validator
+		message   string
+		err       error
+	}{
+		{"any type", Validator{}, "wip: something", nil},
+		{"known type", *NewValidator(DefaultTypes...), "feat: x", nil},
+		{"unknown type", *NewValidator(DefaultTypes...), "feature: x", ErrUnknownType},
+		{"types are case insensitive", *NewValidator(DefaultTypes...), "FEAT: x", nil},
+		{"any scope", Validator{}, "feat(anything): x", nil},
+		{"known scope", Validator{Scopes: []string{"api", "cli"}}, "feat(cli): x", nil},
+		{"unknown scope", Validator{Scopes: []string{"api", "cli"}}, "feat(web): x", ErrUnknownScope},
+		{"scopes are case insensitive", Validator{Scopes: []string{"api"}}, "feat(API): x", nil},
+		{"scope is optional", Validator{Scopes: []string{"api"}}, "feat: x", nil},
+		{"required scope", Validator{RequireScope: true}, "feat: x", ErrMissingScope},
+		{"required scope present", Validator{RequireScope: true}, "feat(api): x", nil},
+		{"header within limit", Validator{MaxHeaderLength: 10}, "feat: abcd", nil},
+		{"header too long", Validator{MaxHeaderLength: 10}, "feat: abcde", ErrHeaderTooLong},
+		{"breaking marker counts towards the header", Validator{MaxHeaderLength: 10}, "feat!: abcd", ErrHeaderTooLong},
+		{"body doesn't count towards the header", Validator{MaxHeaderLength: 10}, "feat: abcd\n\nA much longer body", nil},
+		{"invalid message", Validator{}, "not conventional", ErrInvalidHeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.validator.ValidateMessage(tt.message)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("ValidateMessage(%q) error = %v, want %v", tt.message, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateEmptyDescription(t *testing.T) {
+	if err := NewValidator().Validate(&Commit{Type: "feat"}); !errors.Is(err, ErrEmptyDescription) {
+		t.Errorf("error = %v, want %v", err, ErrEmptyDescription)
+	}
+}
+
+func TestValidateErrorMentionsAllowedValues(t *testing.T) {
+	_, err := NewValidator("feat", "fix").ValidateMessage("docs: x")
+	if err == nil || err.Error() != `unknown commit type "docs", expected one of feat, fix` {
+		t.Errorf("error = %v", err)
+	}
+}
@@ -11,14 +11,15 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/huh"
-	"github.com/charmbracelet/huh/spinner"
-	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/log"
 	"github.com/hashicorp/go-version"
+	"github.com/segersniels/convit/conventional"
+	"github.com/segersniels/convit/generate"
 )
 
 type CommitType struct {
@@ -45,16 +46,44 @@ var CommitTypes = []CommitType{
 	{Type: "chore", SubType: "types", Description: "Add or update types."},
 }
 
+// The names of the known commit types
+func commitTypeNames() []string {
+	var names []string
+	for _, ct := range CommitTypes {
+		if !slices.Contains(names, ct.Type) {
+			names = append(names, ct.Type)
+		}
+	}
+
+	return names
+}
+
+// Remove the type and scope from a conventional commit message
+func stripConventionalPrefix(msg string) string {
+	commit, err := conventional.Parse(msg)
+	if err != nil {
+		return msg
+	}
+
+	return commit.Description
+}
+
+// Check whether a commit subject is conventional and uses one of the known commit types
+func isConventional(subject string) bool {
+	_, err := conventional.NewValidator(commitTypeNames()...).ValidateMessage(subject)
+
+	return err == nil
+}
+
 type Convit struct{}
 
 func NewConvit() *Convit {
 	return &Convit{}
 }
 
-// promptForScope prompts the user for the main commit type and optional sub-type
-func (c *Convit) promptForScope() (string, error) {
-	var main, opt string
-
+// scopeGroups builds the form groups that ask for the main commit type and optional sub-type.
+// The provided scopes are suggested while typing the optional scope.
+func (c *Convit) scopeGroups(main, opt *string, scopes []string) []*huh.Group {
 	options := make([]huh.Option[string], 0, len(CommitTypes))
 	for _, ct := range CommitTypes {
 		optionText := fmt.Sprintf("%s: %s", ct.Type, ct.Description)
@@ -69,12 +98,12 @@ func (c *Convit) promptForScope() (string, error) {
 		options = append(options, huh.NewOption(optionText, optionValue))
 	}
 
-	form := huh.NewForm(
+	return []*huh.Group{
 		huh.NewGroup(
 			huh.NewSelect[string]().
 				Title("Select the type of commit").
 				Options(options...).
-				Value(&main).
+				Value(main).
 				Filtering(true).
 				Validate(func(val string) error {
 					if val == "" {
@@ -87,10 +116,11 @@ func (c *Convit) promptForScope() (string, error) {
 		huh.NewGroup(
 			huh.NewInput().
 				Title("Provide an optional scope (leave empty for none)").
-				Value(&opt),
+				Suggestions(scopes).
+				Value(opt),
 		).WithHideFunc(func() bool {
 			// If the user selects a type with a sub-type, we don't need to ask for the sub-type
-			if regexp.MustCompile(`\((.*?)\)`).MatchString(main) {
+			if regexp.MustCompile(`\((.*?)\)`).MatchString(*main) {
 				return true
 			}
 
@@ -101,30 +131,28 @@ func (c *Convit) promptForScope() (string, error) {
 
 			return false
 		}),
-	)
-
-	if err := form.Run(); err != nil {
-		return "", err
 	}
+}
 
-	// If the user didn't provide an optional sub-type, just return the main type
-	if opt == "" {
-		return main, nil
+// Build a conventional commit from the selected type, which can include a sub-type (eg. `chore(deps)`),
+// the optional scope and the message
+func newCommit(main, opt, msg string) conventional.Commit {
+	typ, scope, _ := strings.Cut(strings.TrimSuffix(main, ")"), "(")
+	if opt != "" {
+		scope = opt
 	}
 
-	return fmt.Sprintf("%s(%s)", main, opt), nil
+	return conventional.Commit{Type: typ, Scope: scope, Description: msg}
 }
 
-// Prompts the user for the commit message
-func (c *Convit) promptForMessage() (string, error) {
-	var msg string
-	if err := huh.NewInput().Title("Enter your commit message").Value(&msg).Run(); err != nil {
-		return "", err
-	}
+func messageInput(msg *string) *huh.Input {
+	return huh.NewInput().Title("Enter your commit message").Value(msg)
+}
 
+// Apply the configured formatting to a commit message provided by the user
+func normalizeMessage(msg string) (string, error) {
 	if len(msg) == 0 {
-		log.Error("Message cannot be empty")
-		os.Exit(0)
+		return "", newValidationError("message cannot be empty")
 	}
 
 	// Ensure the first letter of the message is lowercase
@@ -135,35 +163,190 @@ func (c *Convit) promptForMessage() (string, error) {
 	return msg, nil
 }
 
+// Prompts the user for the commit message, optionally prefilled with an initial value
+func (c *Convit) promptForMessage(initial string) (string, error) {
+	msg := initial
+	if err := messageInput(&msg).Run(); err != nil {
+		return "", err
+	}
+
+	return normalizeMessage(msg)
+}
+
+// Prompt user for commit type, scope, and message and combine them into a conventional commit message.
+// The type and scope guessed from the changes, or required by the path rules, are preselected. When preview is set, the diff is shown alongside the form.
+func (c *Convit) compose(initial string, diff string, preview bool) (string, error) {
+	main, opt := preselect(inferCommit(diff), pathConstraints(diffPaths(diff)))
+	scopes := packageNames(workspacePackages())
+	msg := initial
+
+	if !preview {
+		// Get the commit scope (type and optional sub-type)
+		if err := huh.NewForm(c.scopeGroups(&main, &opt, scopes)...).Run(); err != nil {
+			return "", err
+		}
+
+		// Get the commit message
+		if err := messageInput(&msg).Run(); err != nil {
+			return "", err
+		}
+	} else {
+		groups := append(c.scopeGroups(&main, &opt, scopes), huh.NewGroup(messageInput(&msg)))
+		if err := runWithPreview(huh.NewForm(groups...), diff); err != nil {
+			return "", err
+		}
+	}
+
+	msg, err := normalizeMessage(msg)
+	if err != nil {
+		return "", err
+	}
+
+	// Combine scope and message into a conventional commit format
+	commit := newCommit(main, opt, msg)
+
+	return commit.String(), nil
+}
+
+// Ask the user whether to commit the message. Replaced in tests, where there is no terminal to answer it.
+var confirmMessage = func(msg, description string) (bool, error) {
+	var confirmation bool
+	err := huh.NewConfirm().Title(msg).Description(description).Value(&confirmation).Run()
+
+	return confirmation, err
+}
+
+// Request a commit message for the provided diff from the configured provider
+func (c *Convit) request(ctx context.Context, provider *Provider, diff string, partial bool, msg *string, examples []string) (string, error) {
+	if !partial {
+		msg = nil
+	}
+
+	// Set a timeout for the request
+	ctx, cancel := context.WithTimeout(ctx, provider.timeout)
+	defer cancel()
+
+	suggestion, err := newGenerator(provider, diff, msg, examples).Generate(ctx, diff)
+	if err != nil {
+		return "", err
+	}
+
+	if suggestion.OverriddenType != "" {
+		log.Info("Replaced the suggested type to follow the path rules", "suggested", suggestion.OverriddenType, "type", suggestion.Commit.Type)
+	}
+
+	if suggestion.OverriddenScope != "" {
+		log.Info("Replaced the suggested scope to follow the path rules", "suggested", suggestion.OverriddenScope, "scope", suggestion.Commit.Scope)
+	}
+
+	return suggestion.Message, nil
+}
+
+// Generate a commit message for the provided diff and ask the user for confirmation until they accept one
+func (c *Convit) generate(ctx context.Context, diff string, partial bool, msg *string) (string, error) {
+	if err := prepareCommitIndex(ctx); err != nil {
+		return "", err
+	}
+
+	examples := historyExamplesForDiff(ctx, diff)
+
+	chain := NewProviderChain()
+
+	for {
+		var response string
+
+		before := chain.usage()
+		provider, err := chain.run(ctx, func(ctx context.Context, provider *Provider) error {
+			return runWithSpinner(ctx, "Generating your commit message...", func(ctx context.Context) error {
+				var err error
+				response, err = c.request(ctx, provider, diff, partial, msg, examples)
+				return err
+			})
+		})
+		if err != nil {
+			return "", err
+		}
+
+		// If the response is empty don't bother asking the user for confirmation
+		if len(response) == 0 {
+			return "", errors.New("failed to generate commit message")
+		}
+
+		confirmation, err := confirmMessage(response, fmt.Sprintf("Generated by %s. Do you want to commit this message?", provider.model))
+		if err != nil {
+			return "", err
+		}
+
+		if CONFIG.Data.ShowCost {
+			after := chain.usage()
+			printUsage(provider.model, generate.Usage{
+				InputTokens:  after.InputTokens - before.InputTokens,
+				OutputTokens: after.OutputTokens - before.OutputTokens,
+			})
+		}
+
+		if confirmation {
+			return response, nil
+		}
+	}
+}
+
 // Prompt user for commit type, scope, and message, then execute the commit
-func (c *Convit) Commit() error {
-	// Get the commit scope (type and optional sub-type)
-	scope, err := c.promptForScope()
+func (c *Convit) Commit(preview bool, stage StageOptions, opts CommitOptions) error {
+	err := c.ensureStagedChanges(stage)
 	if err != nil {
 		return err
 	}
 
-	// Get the commit message
-	msg, err := c.promptForMessage()
+	diff, err := getStagedChanges()
 	if err != nil {
 		return err
 	}
 
-	// Combine scope and message into a conventional commit format
-	conv := fmt.Sprintf("%s: %s", scope, msg)
+	warnAboutPackages(diff)
+
+	// Show the staged changes alongside the form if requested
+	conv, err := c.compose("", diff, preview)
+	if err != nil {
+		return err
+	}
 
 	// Execute the git commit command
-	cmd := exec.Command("git", "commit", "-m", conv)
+	return gitCommit(conv, opts)
+}
+
+// Guess the commit message from the changed files and ask the user for confirmation. When declined,
+// the user can adjust it through the commit form.
+func (c *Convit) guess(diff string, msg *string) (string, error) {
+	commit := inferCommit(diff)
+	if commit.Type == "" {
+		commit.Type = "chore"
+	}
+
+	if msg != nil {
+		commit.Description = *msg
+	}
+
+	confirmation, err := confirmMessage(commit.String(), "Do you want to commit this message?")
+	if err != nil {
+		return "", err
+	}
 
-	return cmd.Run()
+	if confirmation {
+		return commit.String(), nil
+	}
+
+	return c.compose(commit.Description, diff, false)
 }
 
-func (c *Convit) Generate(partial bool) error {
-	provider := NewProvider(CONFIG.Data.GenerateModel)
+func (c *Convit) Generate(ctx context.Context, partial, offline bool, stage StageOptions, opts CommitOptions) error {
+	if err := c.ensureStagedChanges(stage); err != nil {
+		return err
+	}
 
 	var msg *string
 	if partial {
-		message, err := c.promptForMessage()
+		message, err := c.promptForMessage("")
 		if err != nil {
 			return err
 		}
@@ -176,47 +359,117 @@ func (c *Convit) Generate(partial bool) error {
 		return err
 	}
 
+	warnAboutPackages(diff)
+
 	var response string
-	for {
-		if err := spinner.New().TitleStyle(lipgloss.NewStyle()).Title("Generating your commit message...").Action(func() {
-			system := prepareSystemMessage(partial)
-			diff := prepareDiff(diff)
+	if offline {
+		response, err = c.guess(diff, msg)
+	} else {
+		response, err = c.generate(ctx, diff, partial, msg)
+	}
 
-			// If partial generation is requested, we need to add the user specified message to the prompt
-			if partial {
-				diff = fmt.Sprintf("message: %s\n\ndiff: %s", *msg, diff)
-			}
+	if err != nil {
+		return err
+	}
 
-			// Set a timeout for the request
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel()
+	return gitCommit(response, opts)
+}
 
-			response, err = provider.client.CreateMessage(ctx, system, diff)
-			if err != nil {
-				log.Fatal(err)
-			}
-		}).Run(); err != nil {
-			return err
+// Come up with a new conventional message for an existing commit, either through the commit form or AI generation.
+// The body of the original message is preserved.
+func (c *Convit) rewordMessage(ctx context.Context, rev string, generate, partial bool) (string, error) {
+	subject, body, err := getCommitMessage(rev)
+	if err != nil {
+		return "", err
+	}
+
+	// Don't carry over an existing type and scope since the user is picking new ones, but a breaking change stays one
+	var breaking bool
+	if commit, err := conventional.Parse(subject); err == nil {
+		breaking = commit.Breaking
+	}
+
+	subject = stripConventionalPrefix(subject)
+
+	var msg string
+	if generate {
+		diff, err := getCommitDiff(rev)
+		if err != nil {
+			return "", err
 		}
 
-		// If the response is empty don't bother asking the user for confirmation
-		if len(response) == 0 {
-			return errors.New("failed to generate commit message")
+		// In partial mode the original subject is kept and only the type and scope are generated
+		if partial {
+			msg, err = c.generate(ctx, diff, true, &subject)
+		} else {
+			msg, err = c.generate(ctx, diff, false, nil)
 		}
 
-		var confirmation bool
-		if err := huh.NewConfirm().Title(response).Description("Do you want to commit this message?").Value(&confirmation).Run(); err != nil {
-			return err
+		if err != nil {
+			return "", err
+		}
+	} else {
+		diff, err := getCommitDiff(rev)
+		if err != nil {
+			return "", err
 		}
 
-		if confirmation {
-			break
+		// Show the changes of the commit alongside the form if requested
+		msg, err = c.compose(subject, diff, CONFIG.Data.ShowDiffPreview)
+		if err != nil {
+			return "", err
 		}
 	}
 
-	cmd := exec.Command("git", "commit", "-m", response)
+	if breaking {
+		msg = markBreaking(msg)
+	}
+
+	if body != "" {
+		msg = fmt.Sprintf("%s\n\n%s", msg, body)
+	}
+
+	return msg, nil
+}
+
+// Mark the header of a conventional message as a breaking change with `!`, if it isn't already
+func markBreaking(msg string) string {
+	commit, err := conventional.Parse(msg)
+	if err != nil || commit.BreakingMarker {
+		return msg
+	}
+
+	commit.Breaking = true
+	commit.BreakingMarker = true
+
+	return commit.String()
+}
+
+// Rewrite the message of the last commit and amend it
+func (c *Convit) Amend(ctx context.Context, generate, partial bool, opts CommitOptions) error {
+	msg, err := c.rewordMessage(ctx, "HEAD", generate, partial)
+	if err != nil {
+		return err
+	}
+
+	opts.Amend = true
+
+	return gitCommit(msg, opts)
+}
+
+// Rewrite the message of an older commit through a scripted rebase
+func (c *Convit) Reword(ctx context.Context, rev string, generate, partial bool, opts CommitOptions) error {
+	sha, err := resolveCommit(rev)
+	if err != nil {
+		return err
+	}
+
+	msg, err := c.rewordMessage(ctx, sha, generate, partial)
+	if err != nil {
+		return err
+	}
 
-	return cmd.Run()
+	return rebaseWithMessages(sha, map[string]string{sha: msg}, opts)
 }
 
 func (c *Convit) Update() error {
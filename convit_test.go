@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Replay the provider traffic recorded in testdata. The cassettes of new tests are recorded by running them with
+// `CONVIT_RECORD` pointing at testdata/cassettes and the API keys of the providers set.
+func replayProvider(t *testing.T, model string) {
+	t.Helper()
+
+	cassettes, err := filepath.Abs(filepath.Join("testdata", "cassettes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if os.Getenv("CONVIT_RECORD") == "" {
+		t.Setenv("CONVIT_RECORD", cassettes)
+		t.Setenv("OPENAI_API_KEY", "")
+		t.Setenv("ANTHROPIC_API_KEY", "")
+	}
+
+	t.Setenv("CONVIT_MODEL", model)
+	t.Setenv("OPENAI_BASE_URL", "")
+	t.Setenv("ANTHROPIC_BASE_URL", "")
+
+	testHome(t)
+	useConfig(t, ConfigData{
+		LowerCaseFirstLetter:  true,
+		GenerateModel:         model,
+		GenerateSystemMessage: SYSTEM_MESSAGE,
+		MaxSubjectLength:      72,
+	})
+}
+
+// Answer the confirmation of the generated message, returning the messages that were shown
+func confirmMessages(t *testing.T, answers ...bool) *[]string {
+	t.Helper()
+
+	var shown []string
+	original := confirmMessage
+	confirmMessage = func(msg, description string) (bool, error) {
+		shown = append(shown, msg)
+		if len(shown) > len(answers) {
+			t.Fatalf("unexpected confirmation of %q", msg)
+		}
+
+		return answers[len(shown)-1], nil
+	}
+
+	t.Cleanup(func() {
+		confirmMessage = original
+	})
+
+	return &shown
+}
+
+// A repository with a single commit and a staged fix on top of it. The dates are fixed so the prompts,
+// and with them the names of the cassettes, are the same on every run.
+func stagedFixRepo(t *testing.T) {
+	t.Helper()
+
+	testRepo(t)
+	t.Setenv("GIT_AUTHOR_DATE", "2024-07-01T12:00:00Z")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-07-01T12:00:00Z")
+
+	writeFile(t, "greet.go", "package greet\n\nfunc Greet(name string) string {\n\treturn \"Hello \" + name\n}\n")
+	runGit(t, "add", ".")
+	runGit(t, "commit", "-q", "-m", "feat: add greeting")
+
+	writeFile(t, "greet.go", "package greet\n\nfunc Greet(name string) string {\n\treturn \"Hello, \" + name + \"!\"\n}\n")
+	runGit(t, "add", ".")
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{GPT4oMini, "fix: add punctuation to the greeting"},
+		{Claude3Dot5Sonnet, "fix: punctuate the greeting"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			replayProvider(t, tt.model)
+			stagedFixRepo(t)
+			shown := confirmMessages(t, true)
+
+			if err := NewConvit().Generate(context.Background(), false, false, StageOptions{}, CommitOptions{}); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(*shown) != 1 || (*shown)[0] != tt.want {
+				t.Errorf("confirmed %q, want %q", *shown, tt.want)
+			}
+
+			if got := strings.TrimSpace(runGit(t, "log", "-1", "--format=%B")); got != tt.want {
+				t.Errorf("commit message = %q, want %q", got, tt.want)
+			}
+
+			if got := runGit(t, "status", "--porcelain"); got != "" {
+				t.Errorf("changes left after committing: %q", got)
+			}
+
+			// The usage of the replayed request ends up in the ledger like any other
+			entries, err := loadUsage()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(entries) != 1 || entries[0].Model != tt.model || entries[0].InputTokens == 0 {
+				t.Errorf("usage = %+v, want a single entry for %s", entries, tt.model)
+			}
+		})
+	}
+}
+
+func TestGenerateRegenerates(t *testing.T) {
+	replayProvider(t, GPT4oMini)
+	stagedFixRepo(t)
+
+	// Declining the message asks for another one, the same request is replayed
+	shown := confirmMessages(t, false, true)
+
+	if err := NewConvit().Generate(context.Background(), false, false, StageOptions{}, CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*shown) != 2 {
+		t.Fatalf("confirmed %q, want two messages", *shown)
+	}
+
+	if got := strings.TrimSpace(runGit(t, "log", "-1", "--format=%s")); got != (*shown)[1] {
+		t.Errorf("commit message = %q, want %q", got, (*shown)[1])
+	}
+}
+
+func TestGenerateOffline(t *testing.T) {
+	replayProvider(t, GPT4oMini)
+	stagedFixRepo(t)
+	shown := confirmMessages(t, true)
+
+	// Guessing the message never reaches the provider, so there is no cassette for it
+	if err := NewConvit().Generate(context.Background(), false, true, StageOptions{}, CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.TrimSpace(runGit(t, "log", "-1", "--format=%s")); got != (*shown)[0] {
+		t.Errorf("commit message = %q, want %q", got, (*shown)[0])
+	}
+}
+
+func TestGenerateEcho(t *testing.T) {
+	fixtures := filepath.Join(t.TempDir(), "fixtures.json")
+	if err := os.WriteFile(fixtures, []byte(`{"echo": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CONVIT_FAKE_FIXTURES", fixtures)
+	replayProvider(t, FakeModel)
+	stagedFixRepo(t)
+	shown := confirmMessages(t, true)
+
+	if err := NewConvit().Generate(context.Background(), false, false, StageOptions{}, CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The echo is shown as is instead of being sanitized into a commit message
+	if len(*shown) != 1 || !strings.HasPrefix((*shown)[0], "system: "+SYSTEM_MESSAGE) || !strings.Contains((*shown)[0], "\n\nprompt: ") {
+		t.Errorf("confirmed %q, want the system message and prompt", *shown)
+	}
+}
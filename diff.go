@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Matches the `@@ -<start>,<count> +<start>,<count> @@` line ranges of a hunk header
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@(.*)$`)
+
+// A single `@@ ... @@` hunk of a file diff
+type DiffHunk struct {
+	Header string
+	Lines  []string
+}
+
+// The changes made to a single file, as produced by `git diff`
+type FileDiff struct {
+	Path string
+	// Everything from the `diff --git` line up to the first hunk (mode changes, renames, binary patches, ...)
+	Header []string
+	Hunks  []DiffHunk
+}
+
+// Parse the output of `git diff` into separate files and hunks
+func parseDiff(diff string) []FileDiff {
+	var (
+		files []FileDiff
+		file  *FileDiff
+		hunk  *DiffHunk
+	)
+
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			files = append(files, FileDiff{Path: pathFromDiffHeader(line)})
+			file = &files[len(files)-1]
+			hunk = nil
+			file.Header = append(file.Header, line)
+		case file == nil:
+			// Anything before the first file (eg. commit information) is ignored
+			continue
+		case strings.HasPrefix(line, "@@"):
+			file.Hunks = append(file.Hunks, DiffHunk{Header: line})
+			hunk = &file.Hunks[len(file.Hunks)-1]
+		case hunk != nil:
+			hunk.Lines = append(hunk.Lines, line)
+		default:
+			file.Header = append(file.Header, line)
+
+			// Prefer the explicit paths over the ambiguous `diff --git` header
+			switch {
+			case strings.HasPrefix(line, "+++ b/"):
+				file.Path = strings.TrimPrefix(line, "+++ b/")
+			case strings.HasPrefix(line, "--- a/") && file.Path == "":
+				file.Path = strings.TrimPrefix(line, "--- a/")
+			case strings.HasPrefix(line, "rename to "):
+				file.Path = strings.TrimPrefix(line, "rename to ")
+			}
+		}
+	}
+
+	return files
+}
+
+// Extract the path from a `diff --git a/<path> b/<path>` line
+func pathFromDiffHeader(line string) string {
+	header := strings.TrimPrefix(line, "diff --git ")
+	if i := strings.LastIndex(header, " b/"); i != -1 {
+		return header[i+len(" b/"):]
+	}
+
+	return header
+}
+
+// Build a patch for the file that only contains the selected hunks
+func (f FileDiff) Patch(hunks ...int) string {
+	var b strings.Builder
+	for _, line := range f.Header {
+		b.WriteString(line + "\n")
+	}
+
+	for _, i := range hunks {
+		b.WriteString(f.Hunks[i].String())
+	}
+
+	return b.String()
+}
+
+// The number of added and removed lines in the file
+func (f FileDiff) Stats() (int, int) {
+	var added, removed int
+	for _, hunk := range f.Hunks {
+		a, r := hunk.Stats()
+		added += a
+		removed += r
+	}
+
+	return added, removed
+}
+
+func (h DiffHunk) String() string {
+	var b strings.Builder
+	b.WriteString(h.Header + "\n")
+	for _, line := range h.Lines {
+		b.WriteString(line + "\n")
+	}
+
+	return b.String()
+}
+
+// The number of added and removed lines in the hunk
+func (h DiffHunk) Stats() (int, int) {
+	var added, removed int
+	for _, line := range h.Lines {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			removed++
+		}
+	}
+
+	return added, removed
+}
+
+// Move the hunk to different starting lines, keeping its contents and line counts as is
+func (h DiffHunk) Move(oldStart, newStart int) DiffHunk {
+	match := hunkHeader.FindStringSubmatch(h.Header)
+	if match == nil {
+		return h
+	}
+
+	oldCount, newCount := "", ""
+	if match[2] != "" {
+		oldCount = "," + match[2]
+	}
+
+	if match[4] != "" {
+		newCount = "," + match[4]
+	}
+
+	h.Header = fmt.Sprintf("@@ -%d%s +%d%s @@%s", oldStart, oldCount, newStart, newCount, match[5])
+
+	return h
+}
+
+// The line the hunk starts at in the original file
+func (h DiffHunk) OldStart() int {
+	match := hunkHeader.FindStringSubmatch(h.Header)
+	if match == nil {
+		return 0
+	}
+
+	start, _ := strconv.Atoi(match[1])
+
+	return start
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const multiHunkDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,4 @@ package main
+ line 1
++added 1
+ line 2
+ line 3
+@@ -10,4 +11,3 @@ func main() {
+ line 10
+-line 11
+-line 12
++changed 12
+ line 13
+diff --git a/docs/new.md b/docs/new.md
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/docs/new.md
+@@ -0,0 +1,2 @@
++# New
++file
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+index 4444444..0000000
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-gone
+diff --git a/logo.png b/logo.png
+index 5555555..6666666 100644
+GIT binary patch
+literal 4
+LcmZQzWMT#Y01f~L
+
+literal 4
+LcmZQzWMT#Y01f~L
+
+diff --git a/before.go b/after.go
+similarity index 100%
+rename from before.go
+rename to after.go
+`
+
+func TestParseDiff(t *testing.T) {
+	files := parseDiff(multiHunkDiff)
+
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+
+	if want := []string{"main.go", "docs/new.md", "old.txt", "logo.png", "after.go"}; !slices.Equal(paths, want) {
+		t.Fatalf("paths = %q, want %q", paths, want)
+	}
+
+	tests := []struct {
+		path    string
+		headers int
+		hunks   int
+		added   int
+		removed int
+	}{
+		{"main.go", 4, 2, 2, 2},
+		{"docs/new.md", 5, 1, 2, 0},
+		{"old.txt", 5, 1, 0, 1},
+		{"logo.png", 9, 0, 0, 0},
+		{"after.go", 4, 0, 0, 0},
+	}
+
+	for i, tt := range tests {
+		file := files[i]
+		if len(file.Header) != tt.headers {
+			t.Errorf("%s: %d header lines, want %d: %q", tt.path, len(file.Header), tt.headers, file.Header)
+		}
+
+		if len(file.Hunks) != tt.hunks {
+			t.Errorf("%s: %d hunks, want %d", tt.path, len(file.Hunks), tt.hunks)
+		}
+
+		added, removed := file.Stats()
+		if added != tt.added || removed != tt.removed {
+			t.Errorf("%s: stats = +%d -%d, want +%d -%d", tt.path, added, removed, tt.added, tt.removed)
+		}
+	}
+}
+
+func TestParseDiffIgnoresCommitInformation(t *testing.T) {
+	files := parseDiff("commit abc\nAuthor: someone\n\n    feat: add file\n\n" + multiHunkDiff)
+	if len(files) != 5 || files[0].Path != "main.go" || files[0].Header[0] != "diff --git a/main.go b/main.go" {
+		t.Fatalf("unexpected files: %+v", files)
+	}
+}
+
+func TestFileDiffPatch(t *testing.T) {
+	file := parseDiff(multiHunkDiff)[0]
+
+	want := `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -10,4 +11,3 @@ func main() {
+ line 10
+-line 11
+-line 12
++changed 12
+ line 13
+`
+
+	if got := file.Patch(1); got != want {
+		t.Errorf("Patch(1) = %q, want %q", got, want)
+	}
+
+	// The binary patch lives in the header, so it is kept as is
+	binary := parseDiff(multiHunkDiff)[3]
+	if got := binary.Patch(); got != multiHunkDiff[strings.Index(multiHunkDiff, "diff --git a/logo.png"):strings.Index(multiHunkDiff, "diff --git a/before.go")] {
+		t.Errorf("binary patch = %q", got)
+	}
+}
+
+func TestDiffHunkMove(t *testing.T) {
+	tests := []struct {
+		header   string
+		old, new int
+		want     string
+		start    int
+	}{
+		{"@@ -10,4 +11,3 @@ func main() {", 8, 9, "@@ -8,4 +9,3 @@ func main() {", 10},
+		{"@@ -1 +0,0 @@", 3, 2, "@@ -3 +2,0 @@", 1},
+		{"@@ -0,0 +1,2 @@", 0, 5, "@@ -0,0 +5,2 @@", 0},
+		{"not a hunk", 1, 1, "not a hunk", 0},
+	}
+
+	for _, tt := range tests {
+		hunk := DiffHunk{Header: tt.header}
+		if got := hunk.OldStart(); got != tt.start {
+			t.Errorf("OldStart(%q) = %d, want %d", tt.header, got, tt.start)
+		}
+
+		if got := hunk.Move(tt.old, tt.new).Header; got != tt.want {
+			t.Errorf("Move(%q, %d, %d) = %q, want %q", tt.header, tt.old, tt.new, got, tt.want)
+		}
+	}
+}
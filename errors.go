@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/charmbracelet/huh"
+	"github.com/segersniels/convit/generate"
+)
+
+// Exit codes for each class of failure so scripts can react to them
+const (
+	ExitCodeFailure    = 1
+	ExitCodeNoChanges  = 2
+	ExitCodeAuth       = 3
+	ExitCodeNetwork    = 4
+	ExitCodeValidation = 5
+	ExitCodeBudget     = 6
+	ExitCodeAborted    = 130
+)
+
+// An error along with the exit code it should be reported with
+type ExitCodeError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitCodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitCodeError) Unwrap() error {
+	return e.Err
+}
+
+func newNoChangesError(msg string) error {
+	return &ExitCodeError{ExitCodeNoChanges, errors.New(msg)}
+}
+
+func newAuthError(err error) error {
+	return &ExitCodeError{ExitCodeAuth, err}
+}
+
+func newNetworkError(err error) error {
+	return &ExitCodeError{ExitCodeNetwork, err}
+}
+
+func newBudgetError(err error) error {
+	return &ExitCodeError{ExitCodeBudget, err}
+}
+
+func newValidationError(msg string) error {
+	return &ExitCodeError{ExitCodeValidation, errors.New(msg)}
+}
+
+var ErrNoStagedChanges = newNoChangesError("no staged changes found")
+
+// Classify an error returned by a provider based on the HTTP status code of the response, if any
+func newProviderError(status int, err error) error {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return newAuthError(err)
+	case status == http.StatusTooManyRequests || status >= http.StatusInternalServerError:
+		return newNetworkError(err)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return newNetworkError(err)
+	}
+
+	return err
+}
+
+// Determine the exit code for an error returned by one of the commands
+func exitCode(err error) int {
+	if errors.Is(err, huh.ErrUserAborted) || errors.Is(err, context.Canceled) {
+		return ExitCodeAborted
+	}
+
+	if errors.Is(err, generate.ErrEmptyDiff) {
+		return ExitCodeNoChanges
+	}
+
+	var exitErr *ExitCodeError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+
+	return ExitCodeFailure
+}
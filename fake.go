@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/segersniels/convit/generate"
+)
+
+var _ MessageClient = (*Fake)(nil)
+
+// The reply of the fake provider when no fixtures are configured
+const FakeDefaultResponse = "chore: update files"
+
+// A response that is returned whenever the prompt matches the pattern
+type FakeRule struct {
+	Match    string `json:"match"`
+	Response string `json:"response"`
+	pattern  *regexp.Regexp
+}
+
+// The fixtures the fake provider replies with. Rules are tried first, then the scripted
+// responses are returned in order (starting over when exhausted) and finally the default.
+type FakeFixtures struct {
+	// Reply with the system message and prompt instead, useful to debug what is sent to a model
+	Echo      bool       `json:"echo"`
+	Rules     []FakeRule `json:"rules"`
+	Responses []string   `json:"responses"`
+	Default   string     `json:"default"`
+}
+
+// A provider that never leaves the machine, for offline demos and testing
+type Fake struct {
+	fixtures FakeFixtures
+
+	mu    sync.Mutex
+	count int
+}
+
+func NewFake(fixtures FakeFixtures) (*Fake, error) {
+	for i, rule := range fixtures.Rules {
+		pattern, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fake rule %q: %v", rule.Match, err)
+		}
+
+		fixtures.Rules[i].pattern = pattern
+	}
+
+	if fixtures.Default == "" {
+		fixtures.Default = FakeDefaultResponse
+	}
+
+	return &Fake{fixtures: fixtures}, nil
+}
+
+// Load the fixtures from the provided JSON file, no fixtures are used when the path is empty
+func loadFakeFixtures(path string) (FakeFixtures, error) {
+	var fixtures FakeFixtures
+	if path == "" {
+		return fixtures, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fixtures, fmt.Errorf("error reading fake fixtures: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return fixtures, fmt.Errorf("error parsing fake fixtures %s: %v", path, err)
+	}
+
+	return fixtures, nil
+}
+
+// Nothing is actually sent anywhere, so the usage is an estimate based on the length of the text
+func fakeUsage(system, prompt, response string) generate.Usage {
+	return generate.Usage{
+		InputTokens:  generate.EstimateTokens(system) + generate.EstimateTokens(prompt),
+		OutputTokens: generate.EstimateTokens(response),
+	}
+}
+
+func (f *Fake) CreateMessage(ctx context.Context, system string, prompt string) (string, generate.Usage, error) {
+	if err := ctx.Err(); err != nil {
+		return "", generate.Usage{}, err
+	}
+
+	response := f.respond(system, prompt)
+
+	return response, fakeUsage(system, prompt, response), nil
+}
+
+func (f *Fake) respond(system string, prompt string) string {
+	if f.fixtures.Echo {
+		return fmt.Sprintf("system: %s\n\nprompt: %s", system, prompt)
+	}
+
+	for _, rule := range f.fixtures.Rules {
+		if rule.pattern.MatchString(prompt) {
+			return rule.Response
+		}
+	}
+
+	if len(f.fixtures.Responses) > 0 {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		response := f.fixtures.Responses[f.count%len(f.fixtures.Responses)]
+		f.count++
+
+		return response
+	}
+
+	return f.fixtures.Default
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/segersniels/convit/generate"
+)
+
+// How long a provider and model are skipped after they failed
+const CircuitBreakerCooldown = 5 * time.Minute
+
+// A provider and model to fall back to when the previous ones fail, the provider is derived from the model when empty
+type Fallback struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
+// The circuit breaker tracks failures per model, since one model of a provider can be down while others still work
+func (f Fallback) key() string {
+	return f.Provider + "/" + f.Model
+}
+
+// The providers to try in order, starting with the configured model followed by the fallbacks.
+// Providers are only created once they are needed.
+type ProviderChain struct {
+	entries   []Fallback
+	providers map[int]*Provider
+}
+
+func NewProviderChain() *ProviderChain {
+	model := generateModel()
+	entries := []Fallback{{providerForModel(model), model}}
+
+	for _, fallback := range CONFIG.Data.Fallbacks {
+		if fallback.Provider == "" {
+			fallback.Provider = providerForModel(fallback.Model)
+		}
+
+		entries = append(entries, fallback)
+	}
+
+	return &ProviderChain{entries, map[int]*Provider{}}
+}
+
+func (c *ProviderChain) provider(i int) (*Provider, error) {
+	if provider, ok := c.providers[i]; ok {
+		return provider, nil
+	}
+
+	provider, err := NewProvider(c.entries[i].Provider, c.entries[i].Model)
+	if err != nil {
+		return nil, err
+	}
+
+	c.providers[i] = provider
+
+	return provider, nil
+}
+
+// Whether the next provider should be tried after the error, ie. when the provider is unreachable or the key is invalid
+func shouldFallback(err error) bool {
+	code := exitCode(err)
+	return code == ExitCodeNetwork || code == ExitCodeAuth
+}
+
+// Run the action against the providers in order until one succeeds, returning the provider that did.
+// Models that failed recently are skipped, unless every one of them did.
+func (c *ProviderChain) run(ctx context.Context, action func(ctx context.Context, provider *Provider) error) (*Provider, error) {
+	breaker := loadCircuitBreaker()
+
+	var candidates []int
+	for i, entry := range c.entries {
+		if breaker.open(entry.key()) {
+			log.Debug("Skipping model that failed recently", "provider", entry.Provider, "model", entry.Model)
+			continue
+		}
+
+		candidates = append(candidates, i)
+	}
+
+	if len(candidates) == 0 {
+		for i := range c.entries {
+			candidates = append(candidates, i)
+		}
+	}
+
+	var err error
+	for n, i := range candidates {
+		entry := c.entries[i]
+
+		var provider *Provider
+		provider, err = c.provider(i)
+		if err == nil {
+			err = action(ctx, provider)
+		}
+
+		if err == nil {
+			breaker.close(entry.key())
+			return provider, nil
+		}
+
+		// Give up when the user cancelled or when the next provider wouldn't do any better
+		if ctx.Err() != nil || !shouldFallback(err) {
+			return nil, err
+		}
+
+		breaker.trip(entry.key())
+
+		if n < len(candidates)-1 {
+			next := c.entries[candidates[n+1]]
+			log.Warn("Falling back to the next model", "failed", entry.Model, "next", next.Model, "error", err)
+		}
+	}
+
+	return nil, err
+}
+
+// The usage of every request made through the providers of the chain so far
+func (c *ProviderChain) usage() generate.Usage {
+	var total generate.Usage
+	for _, provider := range c.providers {
+		total = total.Add(provider.usage())
+	}
+
+	return total
+}
+
+// Remembers when each provider and model last failed so it can be skipped for a while, persisted across runs
+type circuitBreaker map[string]time.Time
+
+func circuitBreakerPath() (string, error) {
+	return configPath("circuit.json")
+}
+
+func loadCircuitBreaker() circuitBreaker {
+	breaker := circuitBreaker{}
+
+	path, err := circuitBreakerPath()
+	if err != nil {
+		return breaker
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return breaker
+	}
+
+	if err := json.Unmarshal(data, &breaker); err != nil {
+		log.Debug("Ignoring invalid circuit breaker state", "error", err)
+		return circuitBreaker{}
+	}
+
+	return breaker
+}
+
+func (b circuitBreaker) save() {
+	path, err := circuitBreakerPath()
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Debug("Failed to save circuit breaker state", "error", err)
+	}
+}
+
+// Whether the provider and model failed within the cooldown
+func (b circuitBreaker) open(key string) bool {
+	failed, ok := b[key]
+	return ok && time.Since(failed) < CircuitBreakerCooldown
+}
+
+func (b circuitBreaker) trip(key string) {
+	b[key] = time.Now()
+	b.save()
+}
+
+func (b circuitBreaker) close(key string) {
+	if _, ok := b[key]; !ok {
+		return
+	}
+
+	delete(b, key)
+	b.save()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// A chain of fake models, the first one being the primary model followed by the fallbacks
+func fakeChain(t *testing.T, models ...string) *ProviderChain {
+	t.Helper()
+
+	t.Setenv("CONVIT_MODEL", models[0])
+	t.Setenv("CONVIT_FAKE_FIXTURES", "")
+
+	var fallbacks []Fallback
+	for _, model := range models[1:] {
+		fallbacks = append(fallbacks, Fallback{Provider: ProviderFake, Model: model})
+	}
+
+	useConfig(t, ConfigData{Fallbacks: fallbacks})
+
+	return NewProviderChain()
+}
+
+// Run the chain, failing with the error of the model if it has one. Returns the models that were tried.
+func runChain(t *testing.T, ctx context.Context, chain *ProviderChain, errs map[string]error) ([]string, *Provider, error) {
+	t.Helper()
+
+	var tried []string
+	provider, err := chain.run(ctx, func(ctx context.Context, provider *Provider) error {
+		tried = append(tried, provider.model)
+		return errs[provider.model]
+	})
+
+	return tried, provider, err
+}
+
+func TestProviderChainFallsBackInOrder(t *testing.T) {
+	testHome(t)
+
+	chain := fakeChain(t, FakeModel, "fake-b", "fake-c")
+	errs := map[string]error{
+		FakeModel: newNetworkError(errors.New("timeout")),
+		"fake-b":  newAuthError(errors.New("invalid key")),
+	}
+
+	tried, provider, err := runChain(t, context.Background(), chain, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{FakeModel, "fake-b", "fake-c"}; !slices.Equal(tried, want) {
+		t.Errorf("tried %q, want %q", tried, want)
+	}
+
+	if provider.model != "fake-c" {
+		t.Errorf("provider = %s, want fake-c", provider.model)
+	}
+
+	// Every model failing returns the last error
+	errs["fake-c"] = newNetworkError(errors.New("outage"))
+	if _, _, err := runChain(t, context.Background(), fakeChain(t, FakeModel, "fake-b", "fake-c"), errs); exitCode(err) != ExitCodeNetwork || err.Error() != "outage" {
+		t.Errorf("err = %v, want the error of the last model", err)
+	}
+}
+
+func TestProviderChainCircuitBreaker(t *testing.T) {
+	testHome(t)
+
+	// Failing models are skipped on the next run
+	errs := map[string]error{FakeModel: newNetworkError(errors.New("timeout"))}
+	runChain(t, context.Background(), fakeChain(t, FakeModel, "fake-b"), errs)
+
+	tried, _, err := runChain(t, context.Background(), fakeChain(t, FakeModel, "fake-b"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"fake-b"}; !slices.Equal(tried, want) {
+		t.Errorf("tried %q while the primary model is skipped, want %q", tried, want)
+	}
+
+	// The breaker is kept per model, so other models of the same provider are still used
+	breaker := loadCircuitBreaker()
+	if !breaker.open(ProviderFake+"/"+FakeModel) || breaker.open(ProviderFake+"/fake-b") {
+		t.Errorf("breaker = %v, want only %s/%s open", breaker, ProviderFake, FakeModel)
+	}
+
+	// Once the cooldown passed the model is tried again and a success closes the breaker
+	breaker[ProviderFake+"/"+FakeModel] = time.Now().Add(-CircuitBreakerCooldown - time.Second)
+	breaker.save()
+
+	tried, _, err = runChain(t, context.Background(), fakeChain(t, FakeModel, "fake-b"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{FakeModel}; !slices.Equal(tried, want) {
+		t.Errorf("tried %q after the cooldown, want %q", tried, want)
+	}
+
+	if breaker := loadCircuitBreaker(); len(breaker) != 0 {
+		t.Errorf("breaker = %v, want it closed", breaker)
+	}
+}
+
+func TestProviderChainAllOpen(t *testing.T) {
+	testHome(t)
+
+	breaker := circuitBreaker{}
+	breaker.trip(ProviderFake + "/" + FakeModel)
+	breaker.trip(ProviderFake + "/fake-b")
+
+	// Every model failed recently, so they are all tried again rather than giving up
+	tried, _, err := runChain(t, context.Background(), fakeChain(t, FakeModel, "fake-b"), map[string]error{FakeModel: newNetworkError(errors.New("timeout"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{FakeModel, "fake-b"}; !slices.Equal(tried, want) {
+		t.Errorf("tried %q, want %q", tried, want)
+	}
+}
+
+func TestProviderChainDoesntFallBack(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+	}{
+		{"cancelled", cancelled, newNetworkError(context.Canceled)},
+		{"over budget", context.Background(), newBudgetError(ErrBudgetExceeded)},
+		{"invalid reply", context.Background(), errors.New("failed to generate commit message")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testHome(t)
+
+			tried, _, err := runChain(t, tt.ctx, fakeChain(t, FakeModel, "fake-b"), map[string]error{FakeModel: tt.err})
+			if err != tt.err {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+
+			if want := []string{FakeModel}; !slices.Equal(tried, want) {
+				t.Errorf("tried %q, want %q", tried, want)
+			}
+
+			if breaker := loadCircuitBreaker(); len(breaker) != 0 {
+				t.Errorf("breaker = %v, want it closed", breaker)
+			}
+		})
+	}
+}
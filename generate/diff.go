@@ -0,0 +1,84 @@
+package generate
+
+import (
+	"strings"
+)
+
+var DefaultIgnoredFiles = []string{
+	"package-lock.json",
+	"yarn.lock",
+	"npm-debug.log",
+	"yarn-debug.log",
+	"yarn-error.log",
+	".pnpm-debug.log",
+	"Cargo.lock",
+	"Gemfile.lock",
+	"mix.lock",
+	"Pipfile.lock",
+	"composer.lock",
+	"go.sum",
+}
+
+func splitDiffIntoChunks(diff string) []string {
+	split := strings.Split(diff, "diff --git")[1:]
+	for i, chunk := range split {
+		split[i] = strings.TrimSpace(chunk)
+	}
+
+	return split
+}
+
+func removeIgnoredFiles(chunks []string, ignored []string) []string {
+	var result []string
+	for _, chunk := range chunks {
+		header := strings.Split(chunk, "\n")[0]
+
+		// Check if the first line contains any of the files to ignore
+		shouldIgnore := false
+		for _, file := range ignored {
+			if strings.Contains(header, file) {
+				shouldIgnore = true
+			}
+		}
+
+		if !shouldIgnore {
+			result = append(result, chunk)
+		}
+	}
+
+	return result
+}
+
+// Split the diff in chunks and remove any ignored files (eg. lock files) to save on tokens
+func PrepareDiff(diff string, ignored []string) string {
+	chunks := splitDiffIntoChunks(diff)
+
+	return strings.Join(removeIgnoredFiles(chunks, ignored), "\n")
+}
+
+// Roughly estimate the amount of tokens in a piece of text, assuming about four characters per token
+func EstimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// Cut the diff down so it roughly fits in the provided amount of tokens
+func TruncateDiff(diff string, tokens int) string {
+	if EstimateTokens(diff) <= tokens {
+		return diff
+	}
+
+	return strings.ToValidUTF8(diff[:tokens*4], "") + "\n[diff truncated]"
+}
+
+// The paths of the files changed in the diff
+func DiffFiles(diff string) []string {
+	var files []string
+	for _, chunk := range splitDiffIntoChunks(diff) {
+		header := strings.Split(chunk, "\n")[0]
+		if i := strings.LastIndex(header, " b/"); i != -1 {
+			files = append(files, header[i+len(" b/"):])
+		}
+	}
+
+	return files
+}
@@ -0,0 +1,272 @@
+// Package generate writes conventional commit messages for a diff with the help of a language model.
+package generate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/segersniels/convit/conventional"
+)
+
+const DefaultSystemMessage string = `Generate a conventional commit message that follows the Conventional Commits specification as described below.
+A scope may be provided to a commit’s type, to provide additional contextual information and is contained within parenthesis, e.g., feat(parser): add ability to parse arrays.
+Base yourself on the adjusted files in the diff and the actual code changes to determine what the type and scope of the message should be.
+Don't include a message body, just the commit title (a single line). Don't surround it in backticks or anything of custom markdown formatting.`
+
+const (
+	FullSuffix    = "You will be given a diff of the changes made to the codebase. You will need to generate a full commit message that includes the type, optional scope, and description of the changes."
+	PartialSuffix = "It is your job to come up with only the type and optional scope based on the provided commit message and staged changes (diff) and then reply with the full commit message. Don't touch the original provided commit message, just include it and don't add stuff to it."
+)
+
+var (
+	ErrEmptyDiff     = errors.New("no changes to generate a commit message for")
+	ErrEmptyResponse = errors.New("failed to generate commit message")
+)
+
+// The amount of tokens a request took
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (u Usage) Add(other Usage) Usage {
+	return Usage{u.InputTokens + other.InputTokens, u.OutputTokens + other.OutputTokens}
+}
+
+// Anything that can answer a prompt, eg. an OpenAI or Anthropic client
+type MessageClient interface {
+	CreateMessage(ctx context.Context, system string, prompt string) (string, Usage, error)
+}
+
+// A commit type along with a description of when it should be used
+type CommitType struct {
+	Type        string
+	Description string
+}
+
+var DefaultTypes = []CommitType{
+	{Type: "chore", Description: "Changes that don't change source code or tests"},
+	{Type: "feat", Description: "Adds or removes a new feature"},
+	{Type: "fix", Description: "Fixes a bug"},
+	{Type: "refactor", Description: "A code change that neither fixes a bug nor adds a feature, eg. renaming a variable, remove dead code, etc."},
+	{Type: "docs", Description: "Documentation only changes"},
+	{Type: "style", Description: "Changes the style of the code eg. linting"},
+	{Type: "perf", Description: "Improves the performance of the code"},
+	{Type: "test", Description: "Adding missing tests or correcting existing tests"},
+	{Type: "build", Description: "Changes that affect the build system or external dependencies (example scopes: gulp, broccoli, npm)"},
+	{Type: "ci", Description: "Changes to CI configuration files and scripts"},
+	{Type: "revert", Description: "Reverts a previous commit"},
+}
+
+// Options that control how a commit message is generated
+type Options struct {
+	// The base system message, defaults to DefaultSystemMessage
+	SystemMessage string
+	// A message written by the user. When provided, only the type and scope are generated.
+	Message string
+	// The types the model can pick from, defaults to DefaultTypes
+	Types []CommitType
+	// The scopes the model should pick from, any scope is allowed when empty
+	Scopes []string
+	// The type the message has to use, the model is free to pick one when empty
+	Type string
+	// The scope the message has to use, the model is free to pick one when empty
+	Scope string
+	// Earlier commit messages whose style the model should follow
+	Examples []string
+	// The current branch and the ticket referenced in it, only used by custom templates by default
+	Branch string
+	Ticket string
+	// The text/template the system message is rendered with, defaults to DefaultSystemTemplate
+	SystemTemplate string
+	// The text/template the prompt is rendered with, defaults to DefaultPromptTemplate
+	PromptTemplate string
+	// Lower case the first letter of generated descriptions
+	LowerCaseFirstLetter bool
+	// The maximum length of the first line of the message, descriptions are cut to fit when set
+	MaxSubjectLength int
+	// Ask for structured output when the client supports it (see StructuredClient), which is validated
+	// against the types and scopes and re-prompted for when invalid
+	Structured bool
+	// Files whose changes are left out of the prompt to save on tokens, defaults to DefaultIgnoredFiles
+	IgnoredFiles []string
+	// The maximum amount of tokens the diff can take up in the prompt, no limit when zero
+	MaxDiffTokens int
+	// Return the reply of the model as is instead of sanitizing it, eg. to debug what is sent to the model
+	Raw bool
+}
+
+// A commit message suggested by the model
+type Suggestion struct {
+	// The message as returned by the model
+	Message string
+	// The parsed message, nil when the model didn't reply with a conventional commit
+	Commit *conventional.Commit
+	// The tokens used to come up with the message, across all attempts
+	Usage Usage
+	// The type and scope the model picked that were replaced by Options.Type and Options.Scope,
+	// empty when nothing was replaced
+	OverriddenType  string
+	OverriddenScope string
+}
+
+type Generator struct {
+	client  MessageClient
+	options Options
+}
+
+func NewGenerator(client MessageClient, options Options) *Generator {
+	if options.SystemMessage == "" {
+		options.SystemMessage = DefaultSystemMessage
+	}
+
+	if options.Types == nil {
+		options.Types = DefaultTypes
+	}
+
+	if options.IgnoredFiles == nil {
+		options.IgnoredFiles = DefaultIgnoredFiles
+	}
+
+	if options.SystemTemplate == "" {
+		options.SystemTemplate = DefaultSystemTemplate
+	}
+
+	if options.PromptTemplate == "" {
+		options.PromptTemplate = DefaultPromptTemplate
+	}
+
+	return &Generator{
+		client,
+		options,
+	}
+}
+
+// List the types along with their description so the model knows when to use which
+func TypeExamples(types []CommitType) string {
+	examples := "Example of the types with the description when they should be used:\n"
+	for _, ct := range types {
+		examples += fmt.Sprintf("- %s: %s\n", ct.Type, ct.Description)
+	}
+
+	return examples
+}
+
+// The variables the templates are rendered with for the provided diff
+func (g *Generator) TemplateData(diff string) TemplateData {
+	// If a partial generation is requested make sure we explicitly mention that we only want the type and scope
+	suffix := FullSuffix
+	if g.options.Message != "" {
+		suffix = PartialSuffix
+	}
+
+	prepared := PrepareDiff(diff, g.options.IgnoredFiles)
+	if g.options.MaxDiffTokens > 0 {
+		prepared = TruncateDiff(prepared, g.options.MaxDiffTokens)
+	}
+
+	return TemplateData{
+		SystemMessage: g.options.SystemMessage,
+		Suffix:        suffix,
+		Types:         g.options.Types,
+		Scopes:        g.options.Scopes,
+		Type:          g.options.Type,
+		Scope:         g.options.Scope,
+		Examples:      g.options.Examples,
+		Branch:        g.options.Branch,
+		Ticket:        g.options.Ticket,
+		Message:       g.options.Message,
+		Diff:          prepared,
+		Files:         DiffFiles(diff),
+	}
+}
+
+// The system message that is sent to the model for the provided diff
+func (g *Generator) SystemMessage(diff string) (string, error) {
+	return renderTemplate("system", g.options.SystemTemplate, g.TemplateData(diff))
+}
+
+// The prompt for the provided diff that is sent to the model
+func (g *Generator) Prompt(diff string) (string, error) {
+	return renderTemplate("prompt", g.options.PromptTemplate, g.TemplateData(diff))
+}
+
+// Generate a commit message for the provided diff
+func (g *Generator) Generate(ctx context.Context, diff string) (*Suggestion, error) {
+	if strings.TrimSpace(diff) == "" {
+		return nil, ErrEmptyDiff
+	}
+
+	system, err := g.SystemMessage(diff)
+	if err != nil {
+		return nil, err
+	}
+
+	prompt, err := g.Prompt(diff)
+	if err != nil {
+		return nil, err
+	}
+
+	if client, ok := g.client.(StructuredClient); ok && g.options.Structured && !g.options.Raw {
+		suggestion, err := g.generateStructured(ctx, client, system, prompt)
+		if err != nil {
+			return nil, err
+		}
+
+		g.enforce(suggestion)
+
+		return suggestion, nil
+	}
+
+	response, usage, err := g.client.CreateMessage(ctx, system, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response) == 0 {
+		return nil, ErrEmptyResponse
+	}
+
+	if g.options.Raw {
+		return &Suggestion{Message: response, Usage: usage}, nil
+	}
+
+	suggestion := &Suggestion{Message: g.Sanitize(response), Usage: usage}
+	if suggestion.Message == "" {
+		return nil, ErrEmptyResponse
+	}
+
+	if commit, err := conventional.Parse(suggestion.Message); err == nil {
+		suggestion.Commit = commit
+		g.enforce(suggestion)
+	}
+
+	return suggestion, nil
+}
+
+// Make sure the suggestion uses the required type and scope, in case the model didn't follow the instructions
+func (g *Generator) enforce(suggestion *Suggestion) {
+	commit := suggestion.Commit
+	if (g.options.Type == "" || commit.Type == g.options.Type) && (g.options.Scope == "" || commit.Scope == g.options.Scope) {
+		return
+	}
+
+	if g.options.Type != "" && commit.Type != g.options.Type {
+		suggestion.OverriddenType = commit.Type
+		commit.Type = g.options.Type
+	}
+
+	if g.options.Scope != "" && commit.Scope != g.options.Scope {
+		suggestion.OverriddenScope = commit.Scope
+		commit.Scope = g.options.Scope
+	}
+
+	// The header changed, so make sure it still fits
+	if g.options.Message == "" {
+		g.tidy(commit)
+	}
+
+	suggestion.Message = commit.String()
+}
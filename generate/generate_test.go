@@ -0,0 +1,64 @@
+package generate
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGenerateEnforcesConstraints(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   Options
+		response  string
+		want      string
+		overrides [2]string
+	}{
+		{"followed", Options{Type: "fix", Scope: "billing"}, "fix(billing): round the totals", "fix(billing): round the totals", [2]string{}},
+		{"type and scope replaced", Options{Type: "fix", Scope: "billing"}, "feat(ui): round the totals", "fix(billing): round the totals", [2]string{"feat", "ui"}},
+		{"missing scope added", Options{Scope: "billing"}, "fix: round the totals", "fix(billing): round the totals", [2]string{}},
+		{"unconstrained", Options{}, "feat(ui): round the totals", "feat(ui): round the totals", [2]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Without structured output the reply is parsed as plain text
+			client := &scriptedClient{responses: []string{tt.response}}
+
+			suggestion, err := NewGenerator(client, tt.options).Generate(context.Background(), structuredDiff)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if suggestion.Message != tt.want {
+				t.Errorf("message = %q, want %q", suggestion.Message, tt.want)
+			}
+
+			if got := [2]string{suggestion.OverriddenType, suggestion.OverriddenScope}; got != tt.overrides {
+				t.Errorf("overridden = %q, want %q", got, tt.overrides)
+			}
+		})
+	}
+}
+
+func TestGeneratePartialKeepsMessage(t *testing.T) {
+	options := Options{Message: "Keep my message", LowerCaseFirstLetter: true}
+
+	// Structured and plain text replies are handled the same way
+	for _, structured := range []bool{true, false} {
+		options.Structured = structured
+
+		client := &scriptedClient{responses: []string{`{"type": "fix", "scope": "cli", "breaking": false, "description": "something else", "body": ""}`}}
+		if !structured {
+			client.responses = []string{"fix(cli): something else"}
+		}
+
+		suggestion, err := NewGenerator(client, options).Generate(context.Background(), structuredDiff)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if suggestion.Message != "fix(cli): Keep my message" {
+			t.Errorf("structured %v: message = %q, want the message of the user", structured, suggestion.Message)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package generate
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/segersniels/convit/conventional"
+)
+
+// Characters models like to wrap their reply in
+const quoteCharacters = "\"'`“”‘’"
+
+// Take the contents of the first fenced code block, if there is one
+func stripCodeFences(response string) string {
+	start := strings.Index(response, "```")
+	if start == -1 {
+		return response
+	}
+
+	// Skip the language of the block, eg. ```text
+	content := response[start+3:]
+	if newline := strings.Index(content, "\n"); newline != -1 && !strings.Contains(content[:newline], "```") {
+		content = content[newline+1:]
+	}
+
+	content, _, _ = strings.Cut(content, "```")
+
+	return content
+}
+
+// Remove list markers, labels and quotes surrounding a line, eg. `- "feat: add x"` or `Commit message: feat: add x`
+func cleanLine(line string) string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimLeft(line, "-*> ")
+
+	for _, label := range []string{"commit message:", "commit:", "message:"} {
+		if strings.HasPrefix(strings.ToLower(line), label) {
+			line = strings.TrimSpace(line[len(label):])
+		}
+	}
+
+	return strings.TrimSpace(strings.Trim(line, quoteCharacters))
+}
+
+// Apply the formatting options to the description of a commit
+func (g *Generator) tidy(commit *conventional.Commit) {
+	description := strings.TrimSpace(commit.Description)
+
+	// Trailing periods aren't part of the conventional style
+	description = strings.TrimRight(description, ".")
+
+	if g.options.LowerCaseFirstLetter && len(description) > 0 {
+		first, size := utf8.DecodeRuneInString(description)
+		description = string(unicode.ToLower(first)) + description[size:]
+	}
+
+	// Cut the description at a word boundary so the header fits in the maximum length
+	if limit := g.options.MaxSubjectLength; limit > 0 {
+		commit.Description = ""
+		available := limit - utf8.RuneCountInString(commit.Header())
+
+		if utf8.RuneCountInString(description) > available {
+			description = truncateWords(description, available)
+		}
+	}
+
+	commit.Description = description
+}
+
+// In a partial generation the message of the user is kept as is, the model only picks the type and scope.
+// Otherwise the formatting options are applied to the generated description.
+func (g *Generator) complete(commit *conventional.Commit) {
+	if g.options.Message == "" {
+		g.tidy(commit)
+		return
+	}
+
+	commit.Description = g.options.Message
+	commit.Body = ""
+	commit.Footers = nil
+	commit.Breaking = false
+	commit.BreakingMarker = false
+}
+
+// Cut the text to at most n characters at a word boundary. A description can't be empty, so the
+// first word is kept when not even that fits (eg. when the type and scope alone are too long).
+func truncateWords(text string, n int) string {
+	runes := []rune(text)
+
+	cut := string(runes[:max(n, 0)])
+	if n > 0 && n < len(runes) && runes[n] != ' ' {
+		if i := strings.LastIndex(cut, " "); i > 0 {
+			cut = cut[:i]
+		}
+	}
+
+	if cut = strings.TrimRight(cut, " ,;:-."); cut != "" {
+		return cut
+	}
+
+	if words := strings.Fields(text); len(words) > 0 {
+		return words[0]
+	}
+
+	return text
+}
+
+func (g *Generator) knownType(typ string) bool {
+	for _, ct := range g.options.Types {
+		if strings.EqualFold(ct.Type, typ) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Normalize a plain text reply of the model: strip code fences and quotes, keep only the
+// first line that looks like a conventional commit and apply the formatting options
+func (g *Generator) Sanitize(response string) string {
+	response = stripCodeFences(strings.TrimSpace(response))
+
+	var first string
+	for _, line := range strings.Split(response, "\n") {
+		line = cleanLine(line)
+		if line == "" {
+			continue
+		}
+
+		if first == "" {
+			first = line
+		}
+
+		// Only known types count, so a line like `Note: ...` isn't mistaken for a commit message
+		commit, err := conventional.Parse(line)
+		if err != nil || !g.knownType(commit.Type) {
+			continue
+		}
+
+		g.complete(commit)
+
+		return commit.String()
+	}
+
+	// Nothing conventional came back, leave it to the user to decide what to do with it
+	return strings.TrimRight(first, ".")
+}
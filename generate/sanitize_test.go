@@ -0,0 +1,103 @@
+package generate
+
+import (
+	"testing"
+
+	"github.com/segersniels/convit/conventional"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{"clean", "feat: add a login page", "feat: add a login page"},
+		{"trailing period", "fix: handle empty input.", "fix: handle empty input"},
+		{"upper case description", "docs(readme): Document the config file", "docs(readme): document the config file"},
+		{"quoted", `"feat(api): add pagination"`, "feat(api): add pagination"},
+		{"backticks", "`chore: bump dependencies`", "chore: bump dependencies"},
+		{"smart quotes", "“refactor: extract the parser”", "refactor: extract the parser"},
+		{"fenced", "```\nfix(cli): exit with the right code\n```", "fix(cli): exit with the right code"},
+		{"fenced with language", "Here you go:\n\n```text\nperf: cache the index\n```\n\nLet me know if you want changes!", "perf: cache the index"},
+		{"label", "Commit message: feat: support dark mode", "feat: support dark mode"},
+		{"list item", "- feat: support dark mode\n- fix: something else", "feat: support dark mode"},
+		{"chatter before the message", "Sure! Based on the diff, here is a commit message:\n\nfix(parser): handle nested arrays.", "fix(parser): handle nested arrays"},
+		{"unknown type is skipped", "Note: the diff is small\nstyle: format the code", "style: format the code"},
+		{"multi-byte first letter", "docs: Ändere die Anleitung", "docs: ändere die Anleitung"},
+		{"breaking change", "feat(api)!: Drop the v1 endpoints", "feat(api)!: drop the v1 endpoints"},
+		{"nothing conventional", "Updated the readme.\nAlso fixed a typo.", "Updated the readme"},
+		{
+			"long description is cut at a word boundary",
+			"feat(config): add an option to configure the maximum length of generated commit subjects",
+			"feat(config): add an option to configure the maximum length of generated",
+		},
+		{
+			"multi-byte characters are cut as a whole",
+			"docs: übersetze die Anleitung für die Konfiguration der maximalen Länge der Betreffzeile ins Deutsche",
+			"docs: übersetze die Anleitung für die Konfiguration der maximalen Länge",
+		},
+		{
+			"punctuation left at the cut is removed",
+			"fix: handle empty input, missing files, broken symlinks and permission errors - with tests",
+			"fix: handle empty input, missing files, broken symlinks and permission",
+		},
+		{
+			"a single long word is cut",
+			"chore: aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			"chore: aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		},
+	}
+
+	generator := NewGenerator(nil, Options{LowerCaseFirstLetter: true, MaxSubjectLength: 72})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generator.Sanitize(tt.response)
+			if got != tt.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.response, got, tt.want)
+			}
+
+			if len([]rune(got)) > 72 {
+				t.Errorf("Sanitize(%q) is %d characters long", tt.response, len([]rune(got)))
+			}
+		})
+	}
+}
+
+func TestSanitizePartial(t *testing.T) {
+	generator := NewGenerator(nil, Options{Message: "Keep This As Is.", LowerCaseFirstLetter: true, MaxSubjectLength: 10})
+
+	tests := []string{
+		"feat(ui): Keep This As Is.",
+		// The model isn't allowed to touch the message of the user, only to pick the type and scope
+		"feat(ui): keep this as is",
+		"feat(ui)!: Something else entirely",
+	}
+
+	for _, response := range tests {
+		if got := generator.Sanitize(response); got != "feat(ui): Keep This As Is." {
+			t.Errorf("Sanitize(%q) = %q, the message of the user should be kept", response, got)
+		}
+	}
+}
+
+func TestTidyLongHeader(t *testing.T) {
+	generator := NewGenerator(nil, Options{MaxSubjectLength: 20})
+
+	// The type and scope alone don't leave any room, the first word is kept since the description can't be empty
+	commit := &conventional.Commit{Type: "feat", Scope: "a-very-long-scope-name", Description: "add a feature"}
+	generator.tidy(commit)
+
+	if commit.Description != "add" {
+		t.Errorf("description = %q, want %q", commit.Description, "add")
+	}
+
+	// The cut happens right before a space, so the last word is kept whole
+	commit = &conventional.Commit{Type: "feat", Description: "add a feature to it"}
+	generator.tidy(commit)
+
+	if commit.Description != "add a feature" {
+		t.Errorf("description = %q, want %q", commit.Description, "add a feature")
+	}
+}
@@ -0,0 +1,136 @@
+package generate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/segersniels/convit/conventional"
+)
+
+// The amount of times the model is asked for a commit message before giving up on an invalid reply
+const MaxStructuredAttempts = 3
+
+// The name of the structured output, used as the name of the schema or tool by the providers
+const StructuredOutputName = "commit_message"
+
+var ErrInvalidStructuredOutput = errors.New("the model kept replying with an invalid commit message")
+
+// A JSON schema describing the structured output the model has to reply with
+type Schema map[string]any
+
+func (s Schema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any(s))
+}
+
+// A client that can be asked to reply with JSON that adheres to a schema, eg. through
+// a JSON schema response format or a forced tool call
+type StructuredClient interface {
+	MessageClient
+	CreateStructuredMessage(ctx context.Context, system string, prompt string, schema Schema) (string, Usage, error)
+}
+
+// The commit message as returned by the model when asking for structured output
+type StructuredCommit struct {
+	Type        string `json:"type"`
+	Scope       string `json:"scope"`
+	Breaking    bool   `json:"breaking"`
+	Description string `json:"description"`
+	Body        string `json:"body"`
+}
+
+// The names of the allowed types. A type can be listed more than once (eg. to describe sub-types), but is only named once.
+func (g *Generator) typeNames() []string {
+	types := make([]string, 0, len(g.options.Types))
+	for _, ct := range g.options.Types {
+		if !slices.Contains(types, ct.Type) {
+			types = append(types, ct.Type)
+		}
+	}
+
+	return types
+}
+
+// The schema of StructuredCommit, limited to the allowed types and scopes
+func (g *Generator) Schema() Schema {
+	scope := Schema{"type": "string", "description": "The optional scope, empty for none"}
+	if len(g.options.Scopes) > 0 {
+		scope["enum"] = append([]string{""}, g.options.Scopes...)
+	}
+
+	return Schema{
+		"type": "object",
+		"properties": Schema{
+			"type":        Schema{"type": "string", "enum": g.typeNames()},
+			"scope":       scope,
+			"breaking":    Schema{"type": "boolean", "description": "Whether the change breaks backwards compatibility"},
+			"description": Schema{"type": "string", "description": "A short summary of the change on a single line"},
+			"body":        Schema{"type": "string", "description": "An optional longer explanation, empty for none"},
+		},
+		"required":             []string{"type", "scope", "breaking", "description", "body"},
+		"additionalProperties": false,
+	}
+}
+
+// Check the structured reply of the model against the options, returning the commit it describes
+func (g *Generator) validate(response string) (*conventional.Commit, error) {
+	var structured StructuredCommit
+	if err := json.Unmarshal([]byte(strings.TrimSpace(response)), &structured); err != nil {
+		return nil, fmt.Errorf("reply is not valid JSON: %v", err)
+	}
+
+	if strings.ContainsAny(structured.Description, "\r\n") {
+		return nil, errors.New("description has to be a single line")
+	}
+
+	commit := &conventional.Commit{
+		Type:        strings.TrimSpace(structured.Type),
+		Scope:       strings.TrimSpace(structured.Scope),
+		Breaking:    structured.Breaking,
+		Description: strings.TrimSpace(structured.Description),
+		Body:        strings.TrimSpace(structured.Body),
+	}
+
+	g.complete(commit)
+
+	validator := conventional.NewValidator(g.typeNames()...)
+	validator.Scopes = g.options.Scopes
+
+	if err := validator.Validate(commit); err != nil {
+		return nil, err
+	}
+
+	return commit, nil
+}
+
+// Ask the model for structured output, re-prompting with the validation error whenever the reply is invalid
+func (g *Generator) generateStructured(ctx context.Context, client StructuredClient, system, prompt string) (*Suggestion, error) {
+	schema := g.Schema()
+
+	var (
+		err   error
+		total Usage
+	)
+
+	for attempt := 0; attempt < MaxStructuredAttempts; attempt++ {
+		response, usage, requestErr := client.CreateStructuredMessage(ctx, system, prompt, schema)
+		if requestErr != nil {
+			return nil, requestErr
+		}
+
+		total = total.Add(usage)
+
+		commit, validationErr := g.validate(response)
+		if validationErr == nil {
+			return &Suggestion{Message: commit.String(), Commit: commit, Usage: total}, nil
+		}
+
+		err = validationErr
+		prompt = fmt.Sprintf("%s\n\nYour previous reply was invalid: %v. Reply again and fix the problem.\n\nprevious reply: %s", prompt, validationErr, response)
+	}
+
+	return nil, fmt.Errorf("%w: %v", ErrInvalidStructuredOutput, err)
+}
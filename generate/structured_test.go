@@ -0,0 +1,110 @@
+package generate
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+// A client replying with the scripted structured responses in order
+type scriptedClient struct {
+	responses []string
+	prompts   []string
+}
+
+func (c *scriptedClient) CreateMessage(ctx context.Context, system string, prompt string) (string, Usage, error) {
+	return c.CreateStructuredMessage(ctx, system, prompt, nil)
+}
+
+func (c *scriptedClient) CreateStructuredMessage(ctx context.Context, system string, prompt string, schema Schema) (string, Usage, error) {
+	c.prompts = append(c.prompts, prompt)
+	response := c.responses[min(len(c.prompts), len(c.responses))-1]
+
+	return response, Usage{InputTokens: 10, OutputTokens: 2}, nil
+}
+
+const structuredDiff = "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-a\n+b\n"
+
+func TestSchemaTypes(t *testing.T) {
+	generator := NewGenerator(nil, Options{Types: []CommitType{
+		{Type: "chore", Description: "Changes that don't change source code or tests"},
+		{Type: "feat", Description: "Adds or removes a new feature"},
+		{Type: "chore", Description: "Release / Version tags"},
+		{Type: "fix", Description: "Fixes a bug"},
+		{Type: "chore", Description: "Add, remove or update dependencies"},
+	}})
+
+	properties := generator.Schema()["properties"].(Schema)
+	types := properties["type"].(Schema)["enum"].([]string)
+
+	if want := []string{"chore", "feat", "fix"}; !slices.Equal(types, want) {
+		t.Errorf("enum = %q, want %q", types, want)
+	}
+}
+
+func TestGenerateStructured(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   Options
+		responses []string
+		want      string
+		attempts  int
+	}{
+		{
+			name:      "valid reply",
+			options:   Options{LowerCaseFirstLetter: true},
+			responses: []string{`{"type": "fix", "scope": "", "breaking": false, "description": "Handle empty input.", "body": ""}`},
+			want:      "fix: handle empty input",
+			attempts:  1,
+		},
+		{
+			name:      "breaking change with a body",
+			options:   Options{},
+			responses: []string{`{"type": "feat", "scope": "api", "breaking": true, "description": "drop v1", "body": "Clients have to move to v2."}`},
+			want:      "feat(api)!: drop v1\n\nClients have to move to v2.",
+			attempts:  1,
+		},
+		{
+			name:    "invalid replies are retried",
+			options: Options{},
+			responses: []string{
+				"not json",
+				`{"type": "feature", "scope": "", "breaking": false, "description": "x", "body": ""}`,
+				`{"type": "feat", "scope": "", "breaking": false, "description": "x", "body": ""}`,
+			},
+			want:     "feat: x",
+			attempts: 3,
+		},
+		{
+			name:      "partial generation only keeps the type and scope",
+			options:   Options{Message: "Keep my message"},
+			responses: []string{`{"type": "fix", "scope": "cli", "breaking": true, "description": "something else", "body": "An invented body"}`},
+			want:      "fix(cli): Keep my message",
+			attempts:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &scriptedClient{responses: tt.responses}
+			tt.options.Structured = true
+
+			suggestion, err := NewGenerator(client, tt.options).Generate(context.Background(), structuredDiff)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if suggestion.Message != tt.want {
+				t.Errorf("message = %q, want %q", suggestion.Message, tt.want)
+			}
+
+			if len(client.prompts) != tt.attempts {
+				t.Errorf("attempts = %d, want %d", len(client.prompts), tt.attempts)
+			}
+
+			if want := (Usage{10 * tt.attempts, 2 * tt.attempts}); suggestion.Usage != want {
+				t.Errorf("usage = %+v, want %+v", suggestion.Usage, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// The default template of the system message. Rendering it with the default options results in the
+// configured system message followed by the type examples and the instructions for a full or partial generation.
+const DefaultSystemTemplate = `{{.SystemMessage}}
+
+{{typeExamples .Types}}
+
+{{.Suffix}}
+{{- if .Scopes}}
+
+Pick the scope from the following list: {{join .Scopes ", "}}.
+{{- end}}
+{{- if .Examples}}
+
+These are recent commit messages of the repository, match their style and phrasing:
+{{- range .Examples}}
+- {{.}}
+{{- end}}
+{{- end}}
+{{- if .Type}}
+
+The type of the commit message must be ` + "`{{.Type}}`" + `, don't use any other type.
+{{- end}}
+{{- if .Scope}}
+
+The scope of the commit message must be ` + "`{{.Scope}}`" + `, don't use any other scope.
+{{- end}}`
+
+// The default template of the prompt, being the diff preceded by the user's message for a partial generation
+const DefaultPromptTemplate = `{{if .Message}}message: {{.Message}}
+
+diff: {{end}}{{.Diff}}`
+
+// The variables available in the system and prompt templates
+type TemplateData struct {
+	// The base system message, see Options.SystemMessage
+	SystemMessage string
+	// The instructions for either a full or partial generation, see FullSuffix and PartialSuffix
+	Suffix string
+	// The types the model can pick from
+	Types []CommitType
+	// The scopes the model should pick from, if any
+	Scopes []string
+	// The type and scope the message has to use, if any
+	Type  string
+	Scope string
+	// Earlier commit messages of the repository
+	Examples []string
+	// The current branch and the ticket referenced in it (eg. `ABC-123`), if any
+	Branch string
+	Ticket string
+	// The message written by the user for a partial generation
+	Message string
+	// The diff without ignored files, truncated to Options.MaxDiffTokens
+	Diff string
+	// The paths of every changed file
+	Files []string
+}
+
+// Functions available in the templates on top of the built-in ones
+var templateFuncs = template.FuncMap{
+	"join":         strings.Join,
+	"typeExamples": TypeExamples,
+}
+
+// Parse a system or prompt template, making the template functions available
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+func renderTemplate(name, text string, data TemplateData) (string, error) {
+	tmpl, err := ParseTemplate(name, text)
+	if err != nil {
+		return "", fmt.Errorf("error parsing %s template: %v", name, err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("error rendering %s template: %v", name, err)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// Options that are forwarded to `git commit`
+type CommitOptions struct {
+	Amend    bool
+	SignOff  bool
+	GPGSign  bool
+	NoVerify bool
+	Author   string
+	Date     string
+	// Arbitrary arguments passed after `--` on the command line
+	Extra []string
+}
+
+// Translate the options into `git commit` arguments
+func (o CommitOptions) args() []string {
+	var args []string
+	if o.Amend {
+		args = append(args, "--amend")
+	}
+
+	if o.SignOff {
+		args = append(args, "--signoff")
+	}
+
+	if o.GPGSign {
+		args = append(args, "--gpg-sign")
+	}
+
+	if o.NoVerify {
+		args = append(args, "--no-verify")
+	}
+
+	if o.Author != "" {
+		args = append(args, "--author", o.Author)
+	}
+
+	if o.Date != "" {
+		args = append(args, "--date", o.Date)
+	}
+
+	return append(args, o.Extra...)
+}
+
+// Run `git commit` with the provided message and options, streaming git's output to the user.
+// When git fails, its exit code is propagated so hook failures don't go unnoticed.
+func gitCommit(msg string, opts CommitOptions) error {
+	args := append([]string{"commit", "-m", msg}, opts.args()...)
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	log.Debug("Running commit command", "command", cmd.String())
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitCodeError{exitErr.ExitCode(), fmt.Errorf("git commit failed: %v", exitErr)}
+	}
+
+	return err
+}
+
+// Run a git command and return its trimmed output
+func gitOutput(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+
+		return "", err
+	}
+
+	return strings.TrimSpace(string(stdout)), nil
+}
+
+// Resolve a revision to its full commit hash
+func resolveCommit(rev string) (string, error) {
+	sha, err := gitOutput("rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil || sha == "" {
+		return "", fmt.Errorf("unknown commit: %s", rev)
+	}
+
+	return sha, nil
+}
+
+// Get the subject and body of an existing commit
+func getCommitMessage(rev string) (string, string, error) {
+	out, err := gitOutput("show", "--no-patch", "--format=%B", rev)
+	if err != nil {
+		return "", "", err
+	}
+
+	subject, body, _ := strings.Cut(out, "\n")
+
+	return strings.TrimSpace(subject), strings.TrimSpace(body), nil
+}
+
+// Get the changes introduced by an existing commit
+func getCommitDiff(rev string) (string, error) {
+	cmd := exec.Command("git", "show", "--format=", rev)
+	stdout, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	if len(stdout) == 0 {
+		return "", fmt.Errorf("no changes found in commit %s", rev)
+	}
+
+	return string(stdout), nil
+}
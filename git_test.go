@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGitCommitExitCode(t *testing.T) {
+	testRepo(t)
+
+	writeFile(t, "main.go", "package main\n")
+	runGit(t, "add", ".")
+
+	// Git exits with 128 on an invalid author. The code survives being wrapped, instead of exiting right away.
+	err := gitCommit("feat: add main", CommitOptions{Author: "nobody"})
+	if code := exitCode(errors.Join(errors.New("wrapped"), err)); code != 128 {
+		t.Errorf("exit code = %d (%v), want 128", code, err)
+	}
+
+	if err := gitCommit("feat: add main", CommitOptions{}); err != nil {
+		t.Errorf("commit: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Create a git repository in a temporary directory and change into it for the duration of the test
+func testRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+
+	// Keep the global and system configuration of the machine out of the tests
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	runGit(t, "init", "-q", "-b", "main")
+	runGit(t, "config", "user.name", "Convit")
+	runGit(t, "config", "user.email", "convit@example.com")
+	runGit(t, "config", "commit.gpgsign", "false")
+
+	return dir
+}
+
+// Run git in the current directory, failing the test when it fails
+func runGit(t *testing.T, args ...string) string {
+	t.Helper()
+
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+
+	return string(out)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Replace the configuration for the duration of the test
+func useConfig(t *testing.T, data ConfigData) {
+	t.Helper()
+
+	original := CONFIG.Data
+	CONFIG.Data = data
+
+	t.Cleanup(func() {
+		CONFIG.Data = original
+	})
+}
+
+// Point the home directory at a temporary one so the ledger and other state stay out of the real one
+func testHome(t *testing.T) string {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	return home
+}
+
+// Numbered lines to build files with several hunks from
+func numberedLines(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+
+	return lines
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The chroma style matching the background of the terminal, in line with the catppuccin theme of the forms
+func highlightStyle() *chroma.Style {
+	if lipgloss.HasDarkBackground() {
+		return styles.Get("catppuccin-mocha")
+	}
+
+	return styles.Get("catppuccin-latte")
+}
+
+// Syntax highlights the lines of a file's hunks with the lexer matching its name
+type highlighter struct {
+	lexer chroma.Lexer
+	style *chroma.Style
+}
+
+// Returns nil when there is no lexer for the file, in which case lines are only colored as a diff
+func newHighlighter(path string, style *chroma.Style) *highlighter {
+	lexer := lexers.Match(path)
+	if lexer == nil {
+		return nil
+	}
+
+	return &highlighter{chroma.Coalesce(lexer), style}
+}
+
+// Color a line of a hunk, highlighting its code while the +/- marker keeps the color of the change
+func (h *highlighter) line(line string) string {
+	if h == nil || line == "" || !strings.ContainsAny(line[:1], "+- ") {
+		return colorDiffLine(line)
+	}
+
+	iterator, err := h.lexer.Tokenise(nil, line[1:])
+	if err != nil {
+		return colorDiffLine(line)
+	}
+
+	var b strings.Builder
+	switch line[0] {
+	case '+':
+		b.WriteString(diffAddedStyle.Render("+"))
+	case '-':
+		b.WriteString(diffRemovedStyle.Render("-"))
+	default:
+		b.WriteString(" ")
+	}
+
+	for _, token := range iterator.Tokens() {
+		value := strings.TrimRight(token.Value, "\n")
+		if value == "" {
+			continue
+		}
+
+		entry := h.style.Get(token.Type)
+
+		style := lipgloss.NewStyle()
+		if entry.Colour.IsSet() {
+			style = style.Foreground(lipgloss.Color(entry.Colour.String()))
+		}
+
+		if entry.Bold == chroma.Yes {
+			style = style.Bold(true)
+		}
+
+		if entry.Italic == chroma.Yes {
+			style = style.Italic(true)
+		}
+
+		b.WriteString(style.Render(value))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// The maximum amount of commits from the history that are included as examples, to keep the prompt small
+const MaxHistoryExamples = 20
+
+// Pull recent conventional commit subjects from the history of the repository so the model can match
+// the way the repository phrases things. When paths are provided, only commits touching them are considered.
+func historyExamples(n int, paths []string) []string {
+	n = min(n, MaxHistoryExamples)
+	if n <= 0 {
+		return nil
+	}
+
+	// Look further back than needed since not every commit is conventional
+	args := []string{"log", "--no-merges", "--format=%s", fmt.Sprintf("--max-count=%d", n*10)}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+
+	out, err := gitOutput(args...)
+	if err != nil {
+		return nil
+	}
+
+	var examples []string
+	for _, subject := range strings.Split(out, "\n") {
+		subject = strings.TrimSpace(subject)
+		if !isConventional(subject) || slices.Contains(examples, subject) {
+			continue
+		}
+
+		examples = append(examples, subject)
+		if len(examples) == n {
+			break
+		}
+	}
+
+	return examples
+}
+
+// The examples to include for a diff according to the user's configuration. Commits that touched
+// similar code come first, followed by the most recent ones.
+func historyExamplesForDiff(ctx context.Context, diff string) []string {
+	var paths []string
+	if CONFIG.Data.HistoryExamplesSamePaths {
+		paths = diffPaths(diff)
+	}
+
+	examples := similarExamples(ctx, diff)
+	for _, example := range historyExamples(CONFIG.Data.HistoryExamples, paths) {
+		if !slices.Contains(examples, example) {
+			examples = append(examples, example)
+		}
+	}
+
+	return examples[:min(len(examples), MaxHistoryExamples)]
+}
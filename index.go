@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// The amount of commits that are indexed when building the index from scratch
+	MaxIndexedCommits = 5000
+	// Bumped whenever the way terms are extracted changes so existing indexes are rebuilt
+	indexVersion = 1
+	// Limits the amount of terms taken from a single diff so huge commits don't dominate the index
+	maxTermsPerDiff = 500
+)
+
+// Matches identifiers in code, eg. `parseDiff` or `MAX_TOKENS`
+var identifierPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]{2,}`)
+
+// A past commit along with the terms describing it
+type indexedCommit struct {
+	SHA     string         `json:"sha"`
+	Subject string         `json:"subject"`
+	Terms   map[string]int `json:"terms"`
+}
+
+// A TF-IDF index of past conventional commits, used to find commits that touched similar code
+type commitIndex struct {
+	Version int `json:"version"`
+	// The last commit that was indexed, later commits are added incrementally
+	Head    string          `json:"head"`
+	Commits []indexedCommit `json:"commits"`
+	// The amount of commits each term appears in
+	Frequencies map[string]int `json:"frequencies"`
+}
+
+// The index is stored in the git directory so it is never committed
+func commitIndexPath() (string, error) {
+	return gitOutput("rev-parse", "--git-path", "convit/index.json")
+}
+
+// Extract the terms describing a diff: the paths and directories of the changed files and the identifiers in the changed lines
+func diffTerms(diff string) map[string]int {
+	terms := map[string]int{}
+
+	count := 0
+	add := func(term string) {
+		if count < maxTermsPerDiff {
+			terms[term]++
+			count++
+		}
+	}
+
+	for _, file := range parseDiff(diff) {
+		add("file:" + path.Base(file.Path))
+		for dir := path.Dir(file.Path); dir != "."; dir = path.Dir(dir) {
+			add("dir:" + dir)
+		}
+
+		for _, hunk := range file.Hunks {
+			for _, line := range hunk.Lines {
+				if !strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "-") {
+					continue
+				}
+
+				for _, identifier := range identifierPattern.FindAllString(line, -1) {
+					add(strings.ToLower(identifier))
+				}
+			}
+		}
+	}
+
+	return terms
+}
+
+// Add the words of a commit subject as terms
+func subjectTerms(terms map[string]int, subject string) {
+	for _, word := range identifierPattern.FindAllString(stripConventionalPrefix(subject), -1) {
+		terms[strings.ToLower(word)]++
+	}
+}
+
+func loadCommitIndex(path string) *commitIndex {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var index commitIndex
+	if err := json.Unmarshal(data, &index); err != nil || index.Version != indexVersion {
+		return nil
+	}
+
+	return &index
+}
+
+func (i *commitIndex) save(path string) error {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return fmt.Errorf("error marshaling commit index: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating commit index directory: %v", err)
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// Index the commits in the range, oldest first. The log is read one commit at a time since the
+// patches of thousands of commits can be huge.
+func (i *commitIndex) add(ctx context.Context, args ...string) error {
+	// Separate the commits with a NUL byte so they can be told apart from the patches
+	args = append([]string{"log", "--no-merges", "--reverse", "--unified=0", "--format=%x00%H %s", "-p"}, args...)
+	cmd := exec.CommandContext(ctx, "git", args...)
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("error reading git log: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return fmt.Errorf("error running git log: %v", err)
+	}
+
+	reader := bufio.NewReader(stdout)
+	for {
+		entry, err := reader.ReadString(0)
+		i.addEntry(strings.TrimSuffix(entry, "\x00"))
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+
+			return fmt.Errorf("error reading git log: %v", err)
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.New(msg)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Index a single commit of the log, skipping the ones that aren't conventional
+func (i *commitIndex) addEntry(entry string) {
+	header, diff, _ := strings.Cut(entry, "\n")
+	sha, subject, ok := strings.Cut(header, " ")
+	if !ok || !isConventional(subject) {
+		return
+	}
+
+	terms := diffTerms(diff)
+	subjectTerms(terms, subject)
+
+	for term := range terms {
+		i.Frequencies[term]++
+	}
+
+	i.Commits = append(i.Commits, indexedCommit{sha, subject, terms})
+}
+
+// Drop the oldest commits once there are too many, so the index doesn't keep growing
+func (i *commitIndex) trim() {
+	if len(i.Commits) <= MaxIndexedCommits {
+		return
+	}
+
+	for _, commit := range i.Commits[:len(i.Commits)-MaxIndexedCommits] {
+		for term := range commit.Terms {
+			if i.Frequencies[term]--; i.Frequencies[term] <= 0 {
+				delete(i.Frequencies, term)
+			}
+		}
+	}
+
+	i.Commits = slices.Clone(i.Commits[len(i.Commits)-MaxIndexedCommits:])
+}
+
+// Load the index and add any commits made since it was last updated. The index is rebuilt
+// when it doesn't exist yet or when the history was rewritten.
+func updateCommitIndex(ctx context.Context) (*commitIndex, error) {
+	path, err := commitIndexPath()
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := gitOutput("rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	index := loadCommitIndex(path)
+	if index != nil && index.Head == head {
+		return index, nil
+	}
+
+	// Only update incrementally when the indexed commit is still part of the history
+	if index != nil && index.Head != "" {
+		if _, err := gitOutput("merge-base", "--is-ancestor", index.Head, head); err != nil {
+			index = nil
+		}
+	}
+
+	if index == nil {
+		index = &commitIndex{Version: indexVersion, Frequencies: map[string]int{}}
+		err = index.add(ctx, fmt.Sprintf("--max-count=%d", MaxIndexedCommits), head)
+	} else {
+		err = index.add(ctx, fmt.Sprintf("%s..%s", index.Head, head))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	index.Head = head
+	index.trim()
+
+	return index, index.save(path)
+}
+
+// The TF-IDF weights of the terms, normalized to unit length
+func (i *commitIndex) weights(terms map[string]int) map[string]float64 {
+	weights := make(map[string]float64, len(terms))
+
+	var norm float64
+	for term, count := range terms {
+		idf := math.Log(float64(len(i.Commits)+1) / float64(i.Frequencies[term]+1))
+		weight := (1 + math.Log(float64(count))) * idf
+		if weight <= 0 {
+			continue
+		}
+
+		weights[term] = weight
+		norm += weight * weight
+	}
+
+	norm = math.Sqrt(norm)
+	for term := range weights {
+		weights[term] /= norm
+	}
+
+	return weights
+}
+
+// The subjects of the k commits most similar to the diff, most similar first
+func (i *commitIndex) similar(diff string, k int) []string {
+	query := i.weights(diffTerms(diff))
+	if len(query) == 0 || k <= 0 {
+		return nil
+	}
+
+	type match struct {
+		subject string
+		score   float64
+	}
+
+	var matches []match
+	for _, commit := range i.Commits {
+		var score float64
+		for term, weight := range i.weights(commit.Terms) {
+			score += weight * query[term]
+		}
+
+		if score > 0 {
+			matches = append(matches, match{commit.Subject, score})
+		}
+	}
+
+	slices.SortStableFunc(matches, func(a, b match) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		}
+
+		return 0
+	})
+
+	var subjects []string
+	for _, m := range matches {
+		if !slices.Contains(subjects, m.subject) {
+			subjects = append(subjects, m.subject)
+		}
+
+		if len(subjects) == k {
+			break
+		}
+	}
+
+	return subjects
+}
+
+// The indexes used by the current command by the directory they were loaded in. A command can ask for
+// examples many times (eg. when regenerating, falling back or rewriting several commits), but the
+// index only has to be updated once.
+var commitIndexes = struct {
+	sync.Mutex
+	byDir map[string]*commitIndex
+}{byDir: map[string]*commitIndex{}}
+
+// The index of the repository in the current directory, updated the first time it is asked for.
+// Nil when it can't be used.
+func currentCommitIndex(ctx context.Context) *commitIndex {
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Debug("Failed to get working directory", "error", err)
+		return nil
+	}
+
+	commitIndexes.Lock()
+	defer commitIndexes.Unlock()
+
+	if index, ok := commitIndexes.byDir[dir]; ok {
+		return index
+	}
+
+	index, err := updateCommitIndex(ctx)
+	if err != nil {
+		log.Debug("Failed to update commit index", "error", err)
+
+		// Try again next time when the update was only interrupted
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+
+	commitIndexes.byDir[dir] = index
+
+	return index
+}
+
+// Build or update the index of the current repository before any request is made, so a first build
+// doesn't eat into the timeout of a request. Only interrupted by the user.
+func prepareCommitIndex(ctx context.Context) error {
+	if CONFIG.Data.SimilarExamples <= 0 {
+		return nil
+	}
+
+	return runWithSpinner(ctx, "Indexing your commit history...", func(ctx context.Context) error {
+		currentCommitIndex(ctx)
+		return nil
+	})
+}
+
+// The past commits most similar to the diff, empty when disabled or when the index can't be used
+func similarExamples(ctx context.Context, diff string) []string {
+	k := min(CONFIG.Data.SimilarExamples, MaxHistoryExamples)
+	if k <= 0 {
+		return nil
+	}
+
+	index := currentCommitIndex(ctx)
+	if index == nil {
+		return nil
+	}
+
+	return index.similar(diff, k)
+}
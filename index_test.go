@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// A repository with commits touching different parts of the code
+func indexedRepo(t *testing.T) {
+	t.Helper()
+
+	testRepo(t)
+
+	commits := []struct {
+		path    string
+		content string
+		message string
+	}{
+		{"parser/lexer.go", "func tokenizeInput() {}\n", "feat(parser): tokenize the input"},
+		{"server/http.go", "func serveRequest() {}\n", "feat(server): serve requests"},
+		{"README.md", "# Readme\n", "not a conventional commit"},
+		{"parser/lexer.go", "func tokenizeInput() {}\nfunc tokenizeNumbers() {}\n", "fix(parser): tokenize numbers"},
+	}
+
+	for _, commit := range commits {
+		writeFile(t, commit.path, commit.content)
+		runGit(t, "add", ".")
+		runGit(t, "commit", "-q", "-m", commit.message)
+	}
+}
+
+func TestCommitIndex(t *testing.T) {
+	indexedRepo(t)
+
+	index, err := updateCommitIndex(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var subjects []string
+	for _, commit := range index.Commits {
+		subjects = append(subjects, commit.Subject)
+	}
+
+	// Oldest first, without the commit that isn't conventional
+	want := []string{"feat(parser): tokenize the input", "feat(server): serve requests", "fix(parser): tokenize numbers"}
+	if !slices.Equal(subjects, want) {
+		t.Fatalf("indexed %q, want %q", subjects, want)
+	}
+
+	diff := "diff --git a/parser/lexer.go b/parser/lexer.go\n--- a/parser/lexer.go\n+++ b/parser/lexer.go\n@@ -1 +1 @@\n-func tokenizeNumbers() {}\n+func tokenizeStrings() {}\n"
+	if got := index.similar(diff, 1); !slices.Equal(got, []string{"fix(parser): tokenize numbers"}) {
+		t.Errorf("similar = %q", got)
+	}
+
+	// Later commits are added to the saved index
+	writeFile(t, "server/http.go", "func serveRequest() {}\nfunc closeServer() {}\n")
+	runGit(t, "commit", "-q", "-am", "feat(server): close the server")
+
+	index, err = updateCommitIndex(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(index.Commits) != 4 || index.Commits[3].Subject != "feat(server): close the server" {
+		t.Errorf("commits after updating = %+v", index.Commits)
+	}
+}
+
+func TestCommitIndexCancelled(t *testing.T) {
+	indexedRepo(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := updateCommitIndex(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+
+	// An interrupted update isn't kept around for the rest of the command
+	if index := currentCommitIndex(ctx); index != nil {
+		t.Errorf("index = %+v, want none", index)
+	}
+
+	if index := currentCommitIndex(context.Background()); index == nil || len(index.Commits) != 3 {
+		t.Errorf("index = %+v, want the 3 conventional commits", index)
+	}
+}
+
+func TestCommitIndexUpdatedOncePerCommand(t *testing.T) {
+	indexedRepo(t)
+
+	first := currentCommitIndex(context.Background())
+	if first == nil {
+		t.Fatal("expected an index")
+	}
+
+	runGit(t, "commit", "-q", "--allow-empty", "-m", "chore: empty")
+
+	if index := currentCommitIndex(context.Background()); index != first {
+		t.Error("index was updated again within the same command")
+	}
+
+	if got := strings.TrimSpace(runGit(t, "rev-parse", "HEAD~1")); first.Head != got {
+		t.Errorf("head = %s, want %s", first.Head, got)
+	}
+}
+
+func TestGenerateIndexesBeforeRequesting(t *testing.T) {
+	fixtures := filepath.Join(t.TempDir(), "fixtures.json")
+	if err := os.WriteFile(fixtures, []byte(`{"echo": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CONVIT_FAKE_FIXTURES", fixtures)
+	t.Setenv("CONVIT_MODEL", FakeModel)
+	testHome(t)
+	useConfig(t, ConfigData{GenerateModel: FakeModel, GenerateSystemMessage: SYSTEM_MESSAGE, SimilarExamples: 1})
+
+	indexedRepo(t)
+	writeFile(t, "parser/lexer.go", "func tokenizeInput() {}\nfunc tokenizeNumbers() {}\nfunc tokenizeStrings() {}\n")
+	runGit(t, "add", ".")
+
+	shown := confirmMessages(t, true)
+
+	if err := NewConvit().Generate(context.Background(), false, false, StageOptions{}, CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The index is built once for the command, outside of the request, and its examples end up in the prompt
+	if index := currentCommitIndex(context.Background()); index == nil || len(index.Commits) != 3 {
+		t.Errorf("index = %+v, want the 3 conventional commits", index)
+	}
+
+	if len(*shown) != 1 || !strings.Contains((*shown)[0], "fix(parser): tokenize numbers") {
+		t.Errorf("confirmed %q, want the similar commit as an example", *shown)
+	}
+}
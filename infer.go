@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/segersniels/convit/conventional"
+)
+
+// A rule that guesses the commit type, and optionally the scope, when every changed file matches one of its patterns.
+// Patterns are globs as understood by matchGlob.
+type InferRule struct {
+	Patterns []string `json:"patterns"`
+	Type     string   `json:"type"`
+	Scope    string   `json:"scope,omitempty"`
+}
+
+var DefaultInferRules = []InferRule{
+	{Patterns: []string{"*.md", "*.mdx", "*.rst", "docs/**"}, Type: "docs"},
+	{Patterns: []string{"*_test.go", "testdata/**"}, Type: "test"},
+	{Patterns: []string{".github/workflows/**", ".gitlab-ci.yml", ".circleci/**"}, Type: "ci"},
+	{
+		Patterns: []string{
+			"go.mod",
+			"go.sum",
+			"package-lock.json",
+			"yarn.lock",
+			"pnpm-lock.yaml",
+			"Cargo.lock",
+			"Gemfile.lock",
+			"composer.lock",
+			"Pipfile.lock",
+			"poetry.lock",
+			"mix.lock",
+		},
+		Type:  "chore",
+		Scope: "deps",
+	},
+}
+
+// The user configured rules take precedence over the default ones
+func inferRules() []InferRule {
+	return append(slices.Clone(CONFIG.Data.InferRules), DefaultInferRules...)
+}
+
+// Whether every file matches at least one of the patterns of the rule
+func (r InferRule) matches(files []string) bool {
+	for _, file := range files {
+		if !slices.ContainsFunc(r.Patterns, func(pattern string) bool { return matchGlob(pattern, file) }) {
+			return false
+		}
+	}
+
+	return len(files) > 0
+}
+
+// The name of the Go package a file belongs to, empty when it can't be determined
+func goPackage(root, file string) string {
+	if !strings.HasSuffix(file, ".go") {
+		return ""
+	}
+
+	f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(root, file), nil, parser.PackageClauseOnly)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(f.Name.Name, "_test")
+}
+
+// The directory all files have in common, empty when they only share the root of the repository
+func commonDir(files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+
+	dir := path.Dir(files[0])
+	for _, file := range files[1:] {
+		for dir != "." && file != dir && !strings.HasPrefix(file, dir+"/") {
+			dir = path.Dir(dir)
+		}
+	}
+
+	if dir == "." {
+		return ""
+	}
+
+	return dir
+}
+
+// Guess a scope from the Go package or the common directory of the files
+func inferScope(root string, files []string) string {
+	var pkg string
+	for _, file := range files {
+		name := goPackage(root, file)
+		if name == "" || (pkg != "" && name != pkg) {
+			pkg = ""
+			break
+		}
+
+		pkg = name
+	}
+
+	// The main package says nothing about what changed
+	if pkg != "" && pkg != "main" {
+		return pkg
+	}
+
+	// Hidden directories (eg. `.github/workflows`) rarely make for a meaningful scope
+	if dir := commonDir(files); dir != "" && !strings.HasPrefix(dir, ".") {
+		return path.Base(dir)
+	}
+
+	return ""
+}
+
+// Describe what happened to the files, eg. `add parser.go` or `update 3 files`
+func inferDescription(files []FileDiff) string {
+	verb := "update"
+	switch {
+	case allFiles(files, "new file mode"):
+		verb = "add"
+	case allFiles(files, "deleted file mode"):
+		verb = "remove"
+	}
+
+	if len(files) == 1 {
+		return fmt.Sprintf("%s %s", verb, path.Base(files[0].Path))
+	}
+
+	return fmt.Sprintf("%s %d files", verb, len(files))
+}
+
+// Whether the header of every file contains a line starting with the prefix
+func allFiles(files []FileDiff, prefix string) bool {
+	for _, file := range files {
+		if !slices.ContainsFunc(file.Header, func(line string) bool { return strings.HasPrefix(line, prefix) }) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Guess the type and scope of a commit from its diff without the help of AI. The type is left empty
+// when none of the rules match.
+func inferCommit(diff string) conventional.Commit {
+	files := parseDiff(diff)
+	paths := diffPaths(diff)
+
+	var commit conventional.Commit
+	if len(files) == 0 {
+		return commit
+	}
+
+	commit.Description = inferDescription(files)
+	for _, rule := range inferRules() {
+		if rule.matches(paths) {
+			commit.Type = rule.Type
+			commit.Scope = rule.Scope
+			break
+		}
+	}
+
+	// In a monorepo the package that changed makes for the best scope
+	if touched := touchedPackages(workspacePackages(), paths); commit.Scope == "" && len(touched) == 1 {
+		commit.Scope = touched[0]
+	}
+
+	if commit.Scope == "" {
+		// Paths in the diff are relative to the root of the repository
+		root, _ := gitOutput("rev-parse", "--show-toplevel")
+		commit.Scope = inferScope(root, paths)
+	}
+
+	// The configured conventions always win over a guess
+	constraints := pathConstraints(paths)
+	if constraints.Type != "" {
+		commit.Type = constraints.Type
+	}
+
+	if constraints.Scope != "" {
+		commit.Scope = constraints.Scope
+	}
+
+	return commit
+}
+
+// The values to preselect in the commit form for a guessed commit. A scope required by the path rules is
+// always used, even when the user isn't prompted for one.
+func preselect(guess conventional.Commit, constraints Constraints) (main, opt string) {
+	if constraints.Scope != "" {
+		opt = constraints.Scope
+	}
+
+	if guess.Type == "" {
+		return "", opt
+	}
+
+	// Prefer a matching sub-type, eg. `chore(deps)`
+	for _, ct := range CommitTypes {
+		if ct.SubType != "" && ct.Type == guess.Type && ct.SubType == guess.Scope {
+			return fmt.Sprintf("%s(%s)", ct.Type, ct.SubType), ""
+		}
+	}
+
+	// Only prefill a guessed scope when the user gets to see it
+	if opt == "" && CONFIG.Data.PromptForOptionalSubType {
+		opt = guess.Scope
+	}
+
+	return guess.Type, opt
+}
@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"slices"
+	"syscall"
 
 	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/log"
 	"github.com/segersniels/config"
+	"github.com/segersniels/convit/generate"
 	"github.com/urfave/cli/v2"
 )
 
@@ -21,30 +25,160 @@ const (
 	GPT4Turbo         = "gpt-4-turbo"
 	GPT3Dot5Turbo     = "gpt-3.5-turbo"
 	Claude3Dot5Sonnet = "claude-3-5-sonnet-20240620"
+	// Replies from a fixtures file instead of a real model, see `CONVIT_FAKE_FIXTURES`
+	FakeModel = "fake"
 )
 
+// The maximum length of the first line of generated messages, as recommended by git
+const DefaultMaxSubjectLength = 72
+
 const (
 	MessageRoleSystem    = "system"
 	MessageRoleUser      = "user"
 	MessageRoleAssistant = "assistant"
 )
 
-type MessageClient interface {
-	CreateMessage(ctx context.Context, system string, prompt string) (string, error)
-}
+type MessageClient = generate.MessageClient
 
 type ConfigData struct {
 	LowerCaseFirstLetter     bool   `json:"lower_case_first_letter"`
 	PromptForOptionalSubType bool   `json:"prompt_for_optional_sub_type"`
 	GenerateModel            string `json:"generate_model"`
 	GenerateSystemMessage    string `json:"generate_prompt"`
+	ShowDiffPreview          bool   `json:"show_diff_preview"`
+	// Timeout in seconds per provider (eg. `openai` or `anthropic`)
+	ProviderTimeouts map[string]int `json:"provider_timeouts"`
+	// Extra rules to guess the commit type and scope from the changed files, tried before the default ones
+	InferRules []InferRule `json:"infer_rules"`
+	// Conventions that always apply a type or scope to changes of matching files, first match wins
+	PathRules []PathRule `json:"path_rules"`
+	// The amount of recent commits to show the model as examples of the repository's style
+	HistoryExamples int `json:"history_examples"`
+	// Only use commits that touched the same files as examples
+	HistoryExamplesSamePaths bool `json:"history_examples_same_paths"`
+	// The amount of past commits that touched similar code to show the model as examples
+	SimilarExamples int `json:"similar_examples"`
+	// Custom text/template for the system message and prompt, the defaults are used when empty
+	SystemTemplate string `json:"system_template"`
+	PromptTemplate string `json:"prompt_template"`
+	// The maximum length of the first line of generated messages. Configs from before the option existed
+	// have it unset, so zero falls back to DefaultMaxSubjectLength and a negative length disables the limit.
+	MaxSubjectLength int `json:"max_subject_length"`
+	// Sampling parameters per model (eg. `gpt-4o-mini`)
+	ModelParameters map[string]ModelParameters `json:"model_parameters"`
+	// Price per million tokens per model, overriding the built-in prices
+	Prices map[string]Price `json:"prices"`
+	// Print the tokens and estimated cost of each generation
+	ShowCost bool `json:"show_cost"`
+	// Caps on the tokens and cost spent, enforced from the usage ledger
+	Budget Budget `json:"budget"`
+	// Models to fall back to, in order, when the configured one fails
+	Fallbacks []Fallback `json:"fallbacks"`
+}
+
+// Flags shared by every command that ends up running `git commit`
+var commitFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:    "signoff",
+		Aliases: []string{"s"},
+		Usage:   "Add a Signed-off-by trailer to the commit",
+	},
+	&cli.BoolFlag{
+		Name:    "gpg-sign",
+		Aliases: []string{"S"},
+		Usage:   "GPG-sign the commit",
+	},
+	&cli.BoolFlag{
+		Name:  "no-verify",
+		Usage: "Bypass the pre-commit and commit-msg hooks",
+	},
+	&cli.StringFlag{
+		Name:  "author",
+		Usage: "Override the commit author",
+	},
+	&cli.StringFlag{
+		Name:  "date",
+		Usage: "Override the author date",
+	},
+}
+
+// Split the positional arguments of a command from the ones after `--`, which are passed on to `git commit`.
+// The flag parser only keeps `--` when it follows a positional argument, so the raw command line is used to
+// tell them apart. Positional arguments beyond the ones the command takes are rejected instead of reaching git.
+func splitCommitArgs(args, raw []string, positional int) ([]string, []string, error) {
+	extra := 0
+	if i := slices.Index(raw, "--"); i != -1 {
+		extra = min(len(raw)-i-1, len(args))
+	}
+
+	positionals := args[:len(args)-extra]
+	if n := len(positionals); n > 0 && positionals[n-1] == "--" {
+		positionals = positionals[:n-1]
+	}
+
+	if len(positionals) > positional {
+		return nil, nil, newValidationError(fmt.Sprintf("unexpected argument %q, git commit flags go after `--`", positionals[positional]))
+	}
+
+	return positionals, args[len(args)-extra:], nil
+}
+
+// Collect the commit flags and the arguments passed after `--`, along with the given amount of positional arguments
+func commitOptionsFromContext(ctx *cli.Context, positional int) (CommitOptions, []string, error) {
+	args, extra, err := splitCommitArgs(ctx.Args().Slice(), os.Args, positional)
+	if err != nil {
+		return CommitOptions{}, nil, err
+	}
+
+	return CommitOptions{
+		SignOff:  ctx.Bool("signoff"),
+		GPGSign:  ctx.Bool("gpg-sign"),
+		NoVerify: ctx.Bool("no-verify"),
+		Author:   ctx.String("author"),
+		Date:     ctx.String("date"),
+		Extra:    extra,
+	}, args, nil
+}
+
+// Flags that control what gets staged before committing
+var stageFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:    "all",
+		Aliases: []string{"a"},
+		Usage:   "Stage all modified and deleted tracked files",
+	},
+	&cli.BoolFlag{
+		Name:    "patch",
+		Aliases: []string{"p"},
+		Usage:   "Interactively pick the hunks to stage",
+	},
+}
+
+func stageOptionsFromContext(ctx *cli.Context) StageOptions {
+	return StageOptions{
+		All:   ctx.Bool("all"),
+		Patch: ctx.Bool("patch"),
+	}
 }
 
+// Flags for commands that rewrite the message of an existing commit
+var rewordFlags = append([]cli.Flag{
+	&cli.BoolFlag{
+		Name:  "generate",
+		Usage: "Write the new commit message with the help of AI",
+	},
+	&cli.BoolFlag{
+		Name:  "partial",
+		Usage: "Keep the original message and only generate the commit type and scope",
+	},
+}, commitFlags...)
+
 var CONFIG = config.NewConfig("convit", ConfigData{
 	LowerCaseFirstLetter:     true,
 	PromptForOptionalSubType: false,
 	GenerateModel:            GPT4oMini,
 	GenerateSystemMessage:    SYSTEM_MESSAGE,
+	MaxSubjectLength:         DefaultMaxSubjectLength,
 })
 
 func main() {
@@ -73,23 +207,159 @@ func main() {
 				},
 			},
 			{
-				Name:  "commit",
-				Usage: "Write a commit message",
+				Name:      "commit",
+				Usage:     "Write a commit message",
+				ArgsUsage: " [-- git commit flags]",
+				Flags: append([]cli.Flag{
+					&cli.BoolFlag{
+						Name:  "preview",
+						Usage: "Show the staged changes alongside the form",
+						Value: CONFIG.Data.ShowDiffPreview,
+					},
+				}, append(stageFlags, commitFlags...)...),
 				Action: func(ctx *cli.Context) error {
-					return convit.Commit()
+					opts, _, err := commitOptionsFromContext(ctx, 0)
+					if err != nil {
+						return err
+					}
+
+					return convit.Commit(ctx.Bool("preview"), stageOptionsFromContext(ctx), opts)
 				},
 			},
 			{
-				Name:  "generate",
-				Usage: "Write a commit message with the help of AI",
-				Flags: []cli.Flag{
+				Name:      "generate",
+				Usage:     "Write a commit message with the help of AI",
+				ArgsUsage: " [-- git commit flags]",
+				Flags: append([]cli.Flag{
 					&cli.BoolFlag{
 						Name:  "partial",
 						Usage: "Only generate the commit type and scope",
 					},
+					&cli.BoolFlag{
+						Name:  "offline",
+						Usage: "Guess the commit message from the changed files without the help of AI",
+					},
+				}, append(stageFlags, commitFlags...)...),
+				Action: func(ctx *cli.Context) error {
+					opts, _, err := commitOptionsFromContext(ctx, 0)
+					if err != nil {
+						return err
+					}
+
+					return convit.Generate(ctx.Context, ctx.Bool("partial"), ctx.Bool("offline"), stageOptionsFromContext(ctx), opts)
+				},
+			},
+			{
+				Name:      "amend",
+				Usage:     "Rewrite the message of the last commit",
+				ArgsUsage: " [-- git commit flags]",
+				Flags:     rewordFlags,
+				Action: func(ctx *cli.Context) error {
+					opts, _, err := commitOptionsFromContext(ctx, 0)
+					if err != nil {
+						return err
+					}
+
+					return convit.Amend(ctx.Context, ctx.Bool("generate"), ctx.Bool("partial"), opts)
+				},
+			},
+			{
+				Name:      "reword",
+				Usage:     "Rewrite the message of an older commit",
+				ArgsUsage: "<commit> [-- git commit flags]",
+				Flags:     rewordFlags,
+				Action: func(ctx *cli.Context) error {
+					opts, args, err := commitOptionsFromContext(ctx, 1)
+					if err != nil {
+						return err
+					}
+
+					if len(args) == 0 {
+						return newValidationError("a commit to reword is required")
+					}
+
+					return convit.Reword(ctx.Context, args[0], ctx.Bool("generate"), ctx.Bool("partial"), opts)
+				},
+			},
+			{
+				Name:      "rewrite",
+				Usage:     "Rewrite the non-conventional commits on a branch with the help of AI",
+				ArgsUsage: "<base>..HEAD [-- git commit flags]",
+				Flags:     commitFlags,
+				Action: func(ctx *cli.Context) error {
+					opts, args, err := commitOptionsFromContext(ctx, 1)
+					if err != nil {
+						return err
+					}
+
+					if len(args) == 0 {
+						return newValidationError("a range of commits to rewrite is required")
+					}
+
+					return convit.Rewrite(ctx.Context, args[0], opts)
+				},
+			},
+			{
+				Name:      "split",
+				Usage:     "Split the staged changes into multiple commits with the help of AI",
+				ArgsUsage: " [-- git commit flags]",
+				Flags: append([]cli.Flag{
+					&cli.BoolFlag{
+						Name:  "continue",
+						Usage: "Continue a split that was interrupted",
+					},
+					&cli.BoolFlag{
+						Name:  "abort",
+						Usage: "Abort a split that was interrupted and restore the staged changes",
+					},
+				}, commitFlags...),
+				Action: func(ctx *cli.Context) error {
+					opts, _, err := commitOptionsFromContext(ctx, 0)
+					if err != nil {
+						return err
+					}
+
+					switch {
+					case ctx.Bool("abort"):
+						return convit.AbortSplit()
+					case ctx.Bool("continue"):
+						return convit.ContinueSplit(opts)
+					default:
+						return convit.Split(ctx.Context, opts)
+					}
+				},
+			},
+			{
+				Name:  "prompt",
+				Usage: "Inspect the prompt that is sent to the model",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "render",
+						Usage: "Render the system message and prompt for the staged changes",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "message",
+								Aliases: []string{"m"},
+								Usage:   "Render the prompt of a partial generation for this message",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							return convit.RenderPrompt(ctx.Context, ctx.String("message"))
+						},
+					},
+				},
+			},
+			{
+				Name:  "usage",
+				Usage: "Report the tokens used and their estimated cost",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "days",
+						Usage: "Only report the usage of the last amount of days",
+					},
 				},
 				Action: func(ctx *cli.Context) error {
-					return convit.Generate(ctx.Bool("partial"))
+					return convit.Usage(ctx.Int("days"))
 				},
 			},
 			{
@@ -113,6 +383,12 @@ func main() {
 										Description("This will ask if you want to specify an optional scope for your commit.").
 										Value(&CONFIG.Data.PromptForOptionalSubType),
 								),
+								huh.NewGroup(
+									huh.NewConfirm().
+										Title("Show a preview of the changes?").
+										Description("This will show the staged changes alongside the commit form.").
+										Value(&CONFIG.Data.ShowDiffPreview),
+								),
 							)
 
 							err := form.Run()
@@ -129,12 +405,20 @@ func main() {
 								Name:  "ai",
 								Usage: "Initialize the AI config",
 								Action: func(ctx *cli.Context) error {
-									models := huh.NewOptions(GPT4oMini, GPT4o, GPT4Turbo, GPT3Dot5Turbo, Claude3Dot5Sonnet)
+									models := huh.NewOptions(GPT4oMini, GPT4o, GPT4Turbo, GPT3Dot5Turbo, Claude3Dot5Sonnet, FakeModel)
 									form := huh.NewForm(
 										huh.NewGroup(
 											huh.NewSelect[string]().Title("Model").Description("Configure the default model").Options(models...).Value(&CONFIG.Data.GenerateModel),
 											huh.NewText().Title("System Message").Description("Configure the default system message").CharLimit(99999).Value(&CONFIG.Data.GenerateSystemMessage),
 										),
+										huh.NewGroup(
+											huh.NewSelect[int]().Title("History examples").Description("Show the model recent commits so it matches the style of the repository").Options(huh.NewOption("None", 0), huh.NewOption("5", 5), huh.NewOption("10", 10), huh.NewOption("20", MaxHistoryExamples)).Value(&CONFIG.Data.HistoryExamples),
+											huh.NewConfirm().Title("Only use commits that touched the same files as examples?").Value(&CONFIG.Data.HistoryExamplesSamePaths),
+											huh.NewSelect[int]().Title("Similar examples").Description("Show the model past commits that touched similar code").Options(huh.NewOption("None", 0), huh.NewOption("3", 3), huh.NewOption("5", 5), huh.NewOption("10", 10)).Value(&CONFIG.Data.SimilarExamples),
+										),
+										huh.NewGroup(
+											huh.NewConfirm().Title("Show the cost of each generation?").Description("This will print the tokens used and the estimated cost after generating a message.").Value(&CONFIG.Data.ShowCost),
+										),
 									)
 
 									err := form.Run()
@@ -142,6 +426,10 @@ func main() {
 										return err
 									}
 
+									if err := promptForModelParameters(CONFIG.Data.GenerateModel); err != nil {
+										return err
+									}
+
 									log.Info("Configuration updated successfully!")
 
 									return CONFIG.Save()
@@ -167,7 +455,25 @@ func main() {
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+	// Cancel any pending work when the user interrupts or terminates convit
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Restore the default behaviour after the first signal so a second one terminates immediately
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := app.RunContext(ctx, os.Args); err != nil {
+		code := exitCode(err)
+
+		// Aborting is a deliberate choice of the user and not worth reporting
+		if code != ExitCodeAborted {
+			log.Error(err)
+		}
+
+		stop()
+		os.Exit(code)
 	}
 }
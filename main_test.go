@@ -0,0 +1,48 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommitArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		raw        string
+		args       []string
+		positional int
+		want       []string
+		extra      []string
+		err        string
+	}{
+		{"nothing", "convit generate", nil, 0, nil, nil, ""},
+		{"flags after the terminator", "convit generate -- --no-edit -v", []string{"--no-edit", "-v"}, 0, nil, []string{"--no-edit", "-v"}, ""},
+		{"stray argument", "convit generate oops", []string{"oops"}, 0, nil, nil, `unexpected argument "oops"`},
+		{"stray argument before the terminator", "convit generate oops -- -v", []string{"oops", "--", "-v"}, 0, nil, nil, `unexpected argument "oops"`},
+		{"positional argument", "convit reword HEAD~2", []string{"HEAD~2"}, 1, []string{"HEAD~2"}, nil, ""},
+		{"positional argument and flags", "convit reword HEAD~2 -- --no-verify", []string{"HEAD~2", "--", "--no-verify"}, 1, []string{"HEAD~2"}, []string{"--no-verify"}, ""},
+		{"too many positional arguments", "convit reword HEAD~2 HEAD~1", []string{"HEAD~2", "HEAD~1"}, 1, nil, nil, `unexpected argument "HEAD~1"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, extra, err := splitCommitArgs(tt.args, strings.Fields(tt.raw), tt.positional)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) || exitCode(err) != ExitCodeValidation {
+					t.Errorf("err = %v, want it to contain %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(args, tt.want) || !slices.Equal(extra, tt.extra) {
+				t.Errorf("split = %q, %q, want %q, %q", args, extra, tt.want, tt.extra)
+			}
+		})
+	}
+}
@@ -2,46 +2,128 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
 
 	openai "github.com/sashabaranov/go-openai"
+	"github.com/segersniels/convit/generate"
 )
 
-var _ MessageClient = (*OpenAI)(nil)
+var _ generate.StructuredClient = (*OpenAI)(nil)
 
 type OpenAI struct {
-	apiKey string
-	model  string
+	apiKey  string
+	model   string
+	params  ModelParameters
+	baseURL string
+	client  *http.Client
 }
 
-func NewOpenAI(apiKey, model string) *OpenAI {
+func NewOpenAI(apiKey, model string, params ModelParameters, baseURL string, client *http.Client) *OpenAI {
 	return &OpenAI{
 		apiKey,
 		model,
+		params,
+		baseURL,
+		client,
 	}
 }
 
-func (o *OpenAI) CreateMessage(ctx context.Context, system string, prompt string) (string, error) {
-	client := openai.NewClient(o.apiKey)
-	resp, err := client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: o.model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: system,
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
+// Send a chat completion request with the system message and prompt
+func (o *OpenAI) send(ctx context.Context, system string, prompt string, format *openai.ChatCompletionResponseFormat) (string, generate.Usage, error) {
+	config := openai.DefaultConfig(o.apiKey)
+	if o.baseURL != "" {
+		config.BaseURL = strings.TrimSuffix(o.baseURL, "/")
+	}
+
+	if o.client != nil {
+		config.HTTPClient = o.client
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model: o.model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: system,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
 			},
 		},
-	)
+		ResponseFormat: format,
+		MaxTokens:      o.params.MaxTokens,
+		Stop:           o.params.Stop,
+		Seed:           o.params.Seed,
+	}
+
+	// Zero values are omitted from the request, so the smallest possible value is sent to get a temperature of zero
+	if o.params.Temperature != nil {
+		request.Temperature = max(*o.params.Temperature, math.SmallestNonzeroFloat32)
+	}
+
+	if o.params.TopP != nil {
+		request.TopP = max(*o.params.TopP, math.SmallestNonzeroFloat32)
+	}
+
+	client := openai.NewClientWithConfig(config)
+	resp, err := client.CreateChatCompletion(ctx, request)
 
 	if err != nil {
-		return "", err
+		var (
+			apiErr *openai.APIError
+			reqErr *openai.RequestError
+		)
+
+		switch {
+		case errors.As(err, &apiErr):
+			return "", generate.Usage{}, newProviderError(apiErr.HTTPStatusCode, err)
+		case errors.As(err, &reqErr):
+			return "", generate.Usage{}, newProviderError(reqErr.HTTPStatusCode, err)
+		default:
+			return "", generate.Usage{}, newProviderError(0, err)
+		}
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	usage := generate.Usage{InputTokens: resp.Usage.PromptTokens, OutputTokens: resp.Usage.CompletionTokens}
+	if len(resp.Choices) == 0 {
+		return "", usage, nil
+	}
+
+	return resp.Choices[0].Message.Content, usage, nil
+}
+
+func (o *OpenAI) CreateMessage(ctx context.Context, system string, prompt string) (string, generate.Usage, error) {
+	return o.send(ctx, system, prompt, nil)
+}
+
+// Ask for a reply that strictly follows the JSON schema. Older models don't support schemas,
+// so they are asked for a JSON object with the schema described in the system message instead.
+func (o *OpenAI) CreateStructuredMessage(ctx context.Context, system string, prompt string, schema generate.Schema) (string, generate.Usage, error) {
+	if o.model == GPT3Dot5Turbo || o.model == GPT4Turbo {
+		definition, err := json.Marshal(schema)
+		if err != nil {
+			return "", generate.Usage{}, fmt.Errorf("error marshaling JSON schema: %v", err)
+		}
+
+		system = fmt.Sprintf("%s\n\nReply with a JSON object that follows this JSON schema: %s", system, definition)
+
+		return o.send(ctx, system, prompt, &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		})
+	}
+
+	return o.send(ctx, system, prompt, &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   generate.StructuredOutputName,
+			Schema: schema,
+			Strict: true,
+		},
+	})
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+)
+
+// Plenty for a commit message, even one with a body or a split plan
+const DefaultMaxTokens = 1024
+
+// Sampling parameters for a model, unset values are left to the provider
+type ModelParameters struct {
+	Temperature *float32 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	TopP        *float32 `json:"top_p,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	// Only supported by OpenAI
+	Seed *int `json:"seed,omitempty"`
+}
+
+// The configured parameters for a model
+func modelParameters(model string) ModelParameters {
+	params := CONFIG.Data.ModelParameters[model]
+	if params.MaxTokens <= 0 {
+		params.MaxTokens = DefaultMaxTokens
+	}
+
+	return params
+}
+
+func formatOptionalFloat(value *float32) string {
+	if value == nil {
+		return ""
+	}
+
+	return strconv.FormatFloat(float64(*value), 'f', -1, 32)
+}
+
+func parseOptionalFloat(value string) (*float32, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a number", value)
+	}
+
+	result := float32(parsed)
+
+	return &result, nil
+}
+
+func formatOptionalInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+
+	return strconv.Itoa(*value)
+}
+
+func parseOptionalInt(value string) (*int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a whole number", value)
+	}
+
+	return &parsed, nil
+}
+
+// Validate that the value is empty or a number within the range
+func validateOptionalFloat(min, max float64) func(string) error {
+	return func(value string) error {
+		parsed, err := parseOptionalFloat(value)
+		if err != nil || parsed == nil {
+			return err
+		}
+
+		if float64(*parsed) < min || float64(*parsed) > max {
+			return fmt.Errorf("has to be between %g and %g", min, max)
+		}
+
+		return nil
+	}
+}
+
+func validateOptionalInt(value string) error {
+	_, err := parseOptionalInt(value)
+
+	return err
+}
+
+// The model parameters as text so they can be edited in a form
+type modelParametersInput struct {
+	Temperature string
+	MaxTokens   string
+	TopP        string
+	Stop        string
+	Seed        string
+}
+
+func newModelParametersInput(params ModelParameters) modelParametersInput {
+	input := modelParametersInput{
+		Temperature: formatOptionalFloat(params.Temperature),
+		TopP:        formatOptionalFloat(params.TopP),
+		Stop:        strings.Join(params.Stop, ", "),
+		Seed:        formatOptionalInt(params.Seed),
+	}
+
+	if params.MaxTokens > 0 {
+		input.MaxTokens = strconv.Itoa(params.MaxTokens)
+	}
+
+	return input
+}
+
+// Convert the edited text back to parameters, assuming the input was validated
+func (i modelParametersInput) parameters() ModelParameters {
+	var params ModelParameters
+	params.Temperature, _ = parseOptionalFloat(i.Temperature)
+	params.TopP, _ = parseOptionalFloat(i.TopP)
+	params.Seed, _ = parseOptionalInt(i.Seed)
+
+	if maxTokens, _ := parseOptionalInt(i.MaxTokens); maxTokens != nil {
+		params.MaxTokens = *maxTokens
+	}
+
+	for _, stop := range strings.Split(i.Stop, ",") {
+		if stop = strings.TrimSpace(stop); stop != "" {
+			params.Stop = append(params.Stop, stop)
+		}
+	}
+
+	return params
+}
+
+// Prompts the user for the parameters of the model and stores them in the configuration
+func promptForModelParameters(model string) error {
+	input := newModelParametersInput(CONFIG.Data.ModelParameters[model])
+
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewNote().Title(fmt.Sprintf("Parameters for %s", model)).Description("Leave a field empty to use the default of the provider"),
+			huh.NewInput().Title("Temperature").Description("Lower values make the output more predictable (0-2)").Validate(validateOptionalFloat(0, 2)).Value(&input.Temperature),
+			huh.NewInput().Title("Max tokens").Description(fmt.Sprintf("The maximum length of the reply (defaults to %d)", DefaultMaxTokens)).Validate(validateOptionalInt).Value(&input.MaxTokens),
+			huh.NewInput().Title("Top P").Description("Only sample from the most likely tokens (0-1)").Validate(validateOptionalFloat(0, 1)).Value(&input.TopP),
+			huh.NewInput().Title("Stop sequences").Description("Comma separated sequences at which the reply stops").Value(&input.Stop),
+			huh.NewInput().Title("Seed").Description("Makes the output more reproducible, only supported by OpenAI").Validate(validateOptionalInt).Value(&input.Seed),
+		),
+	)
+
+	if err := form.Run(); err != nil {
+		return err
+	}
+
+	if CONFIG.Data.ModelParameters == nil {
+		CONFIG.Data.ModelParameters = map[string]ModelParameters{}
+	}
+
+	CONFIG.Data.ModelParameters[model] = input.parameters()
+
+	return nil
+}
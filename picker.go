@@ -0,0 +1,350 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	pickerTitleStyle   = lipgloss.NewStyle().Bold(true)
+	pickerCursorStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("5")).Bold(true)
+	pickerHelpStyle    = lipgloss.NewStyle().Faint(true)
+	pickerPreviewStyle = lipgloss.NewStyle().Border(lipgloss.NormalBorder(), true, false, false, false).BorderForeground(lipgloss.Color("8"))
+	diffAddedStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	diffRemovedStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	diffHeaderStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	diffContextStyle   = lipgloss.NewStyle().Faint(true)
+)
+
+// Color a single line of a diff
+func colorDiffLine(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"), strings.HasPrefix(line, "diff --git"):
+		return pickerTitleStyle.Render(line)
+	case strings.HasPrefix(line, "@@"):
+		return diffHeaderStyle.Render(line)
+	case strings.HasPrefix(line, "+"):
+		return diffAddedStyle.Render(line)
+	case strings.HasPrefix(line, "-"):
+		return diffRemovedStyle.Render(line)
+	default:
+		return diffContextStyle.Render(line)
+	}
+}
+
+// A line of the preview, the lines of hunks are syntax highlighted
+type pickerLine struct {
+	text string
+	code bool
+}
+
+// A bubbletea model that lets the user toggle the hunks they want to stage
+type hunkPicker struct {
+	files    []FileDiff
+	units    []splitUnit
+	selected map[int]bool
+	cursor   int
+	// The first line of the preview that is shown
+	scroll  int
+	width   int
+	height  int
+	aborted bool
+	// The highlighter per file, created once the file is previewed
+	style        *chroma.Style
+	highlighters map[int]*highlighter
+}
+
+func newHunkPicker(files []FileDiff) *hunkPicker {
+	return &hunkPicker{
+		files:        files,
+		units:        splitUnits(files),
+		selected:     make(map[int]bool),
+		height:       24,
+		style:        highlightStyle(),
+		highlighters: make(map[int]*highlighter),
+	}
+}
+
+func (p *hunkPicker) Init() tea.Cmd {
+	return nil
+}
+
+func (p *hunkPicker) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		p.width, p.height = msg.Width, msg.Height
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			p.aborted = true
+			return p, tea.Quit
+		case "enter":
+			return p, tea.Quit
+		case "up", "k":
+			if p.cursor > 0 {
+				p.cursor--
+				p.scroll = 0
+			}
+		case "down", "j":
+			if p.cursor < len(p.units)-1 {
+				p.cursor++
+				p.scroll = 0
+			}
+		case " ", "x":
+			p.selected[p.cursor] = !p.selected[p.cursor]
+		case "a":
+			// Select everything, or deselect everything when all hunks already are
+			all := len(p.selectedUnits()) != len(p.units)
+			for i := range p.units {
+				p.selected[i] = all
+			}
+		case "pgdown", "J":
+			p.scroll += p.previewHeight() / 2
+		case "pgup", "K":
+			p.scroll = max(0, p.scroll-p.previewHeight()/2)
+		}
+	}
+
+	return p, nil
+}
+
+// The label of a unit in the list
+func (p *hunkPicker) label(unit splitUnit) string {
+	file := p.files[unit.file]
+	if unit.hunk == -1 {
+		added, removed := file.Stats()
+		return fmt.Sprintf("%s (+%d -%d)", file.Path, added, removed)
+	}
+
+	added, removed := file.Hunks[unit.hunk].Stats()
+	return fmt.Sprintf("%s hunk %d/%d (+%d -%d)", file.Path, unit.hunk+1, len(file.Hunks), added, removed)
+}
+
+// The height of the list, leaving the rest of the screen for the preview
+func (p *hunkPicker) listHeight() int {
+	return min(len(p.units), max(3, p.height/3))
+}
+
+func (p *hunkPicker) previewHeight() int {
+	// Leave room for the title, help and preview border
+	return max(1, p.height-p.listHeight()-4)
+}
+
+// The lines of the hunk under the cursor, or of the entire file including its header
+func (p *hunkPicker) preview() []pickerLine {
+	unit := p.units[p.cursor]
+	file := p.files[unit.file]
+
+	var lines []pickerLine
+
+	hunks := file.Hunks
+	if unit.hunk != -1 {
+		hunks = hunks[unit.hunk : unit.hunk+1]
+	} else {
+		for _, line := range file.Header {
+			lines = append(lines, pickerLine{line, false})
+		}
+	}
+
+	for _, hunk := range hunks {
+		lines = append(lines, pickerLine{hunk.Header, false})
+		for _, line := range hunk.Lines {
+			lines = append(lines, pickerLine{line, true})
+		}
+	}
+
+	return lines
+}
+
+func (p *hunkPicker) highlighter(file int) *highlighter {
+	h, ok := p.highlighters[file]
+	if !ok {
+		h = newHighlighter(p.files[file].Path, p.style)
+		p.highlighters[file] = h
+	}
+
+	return h
+}
+
+func (p *hunkPicker) View() string {
+	var b strings.Builder
+	b.WriteString(pickerTitleStyle.Render(fmt.Sprintf("Select the hunks to stage (%d/%d)", len(p.selectedUnits()), len(p.units))) + "\n")
+
+	// Keep the cursor in view when the list is taller than the available space
+	height := p.listHeight()
+	start := max(0, min(p.cursor-height/2, len(p.units)-height))
+	for i := start; i < start+height; i++ {
+		check := "[ ]"
+		if p.selected[i] {
+			check = "[x]"
+		}
+
+		line := fmt.Sprintf("%s %s", check, p.label(p.units[i]))
+		if i == p.cursor {
+			line = pickerCursorStyle.Render("> " + line)
+		} else {
+			line = "  " + line
+		}
+
+		b.WriteString(line + "\n")
+	}
+
+	lines := p.preview()
+	p.scroll = min(p.scroll, max(0, len(lines)-p.previewHeight()))
+	end := min(len(lines), p.scroll+p.previewHeight())
+
+	highlighter := p.highlighter(p.units[p.cursor].file)
+
+	colored := make([]string, 0, end-p.scroll)
+	for _, line := range lines[p.scroll:end] {
+		if line.code {
+			colored = append(colored, highlighter.line(line.text))
+		} else {
+			colored = append(colored, colorDiffLine(line.text))
+		}
+	}
+
+	// Cut off long lines instead of wrapping them so the layout stays intact
+	preview := pickerPreviewStyle
+	if p.width > 0 {
+		preview = preview.MaxWidth(p.width)
+	}
+
+	b.WriteString(preview.Render(strings.Join(colored, "\n")) + "\n")
+	b.WriteString(pickerHelpStyle.Render("↑/↓ move • space toggle • a toggle all • pgup/pgdown scroll • enter confirm • esc cancel"))
+
+	return b.String()
+}
+
+func (p *hunkPicker) selectedUnits() []splitUnit {
+	var units []splitUnit
+	for i, unit := range p.units {
+		if p.selected[i] {
+			units = append(units, unit)
+		}
+	}
+
+	return units
+}
+
+// Build a single patch containing every selected hunk
+func (p *hunkPicker) patch() string {
+	selected := make(map[int][]int)
+	for _, unit := range p.selectedUnits() {
+		selected[unit.file] = append(selected[unit.file], unit.hunk)
+	}
+
+	var patch string
+	for i, file := range p.files {
+		hunks, ok := selected[i]
+		if !ok {
+			continue
+		}
+
+		if hunks[0] == -1 {
+			hunks = make([]int, len(file.Hunks))
+			for j := range hunks {
+				hunks[j] = j
+			}
+		}
+
+		patch += splitPatch(file, i, hunks, make(map[splitUnit]bool))
+	}
+
+	return patch
+}
+
+// The unstaged changes, with untracked files as new files so they can be picked as well
+func getUnstagedDiff() (string, error) {
+	diff, err := exec.Command("git", "diff", "--binary").Output()
+	if err != nil {
+		return "", err
+	}
+
+	// Untracked files of the whole repository, relative to its root like the paths in the diff
+	untracked, err := exec.Command("git", "ls-files", "--others", "--exclude-standard", "--full-name", "-z", ":/").Output()
+	if err != nil {
+		return "", err
+	}
+
+	root, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+
+	patches := string(diff)
+	for _, path := range strings.Split(string(untracked), "\x00") {
+		if path == "" {
+			continue
+		}
+
+		// Exits with 1 since the file differs from the empty one
+		patch, err := exec.Command("git", "-C", root, "diff", "--no-index", "--binary", "--", os.DevNull, path).Output()
+
+		var exitErr *exec.ExitError
+		if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+			return "", fmt.Errorf("error creating patch for %s: %v", path, err)
+		}
+
+		patches += string(patch)
+	}
+
+	return patches, nil
+}
+
+// Let the user pick the hunks of the unstaged changes that should be staged
+func (c *Convit) pickHunks() error {
+	diff, err := getUnstagedDiff()
+	if err != nil {
+		return err
+	}
+
+	files := parseDiff(diff)
+	if len(files) == 0 {
+		return nil
+	}
+
+	picker := newHunkPicker(files)
+	if _, err := tea.NewProgram(picker, tea.WithAltScreen()).Run(); err != nil {
+		return err
+	}
+
+	if picker.aborted {
+		return huh.ErrUserAborted
+	}
+
+	patch := picker.patch()
+	if patch == "" {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "convit-stage-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "selection.patch")
+	if err := os.WriteFile(file, []byte(patch), 0o600); err != nil {
+		return err
+	}
+
+	// Paths in the patch are relative to the root, applying it from a subdirectory would skip the ones outside of it
+	root, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+
+	_, err = gitOutput("-C", root, "apply", "--cached", file)
+
+	return err
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/muesli/termenv"
+)
+
+func TestPickerIncludesUntrackedFiles(t *testing.T) {
+	testRepo(t)
+
+	writeFile(t, "main.go", "package main\n")
+	runGit(t, "add", ".")
+	runGit(t, "commit", "-q", "-m", "chore: initial commit")
+
+	writeFile(t, "main.go", "package main\n\nfunc main() {}\n")
+	writeFile(t, "docs/new.md", "# New\n")
+	writeFile(t, "empty.txt", "")
+	writeFile(t, "ignored.log", "ignored\n")
+	writeFile(t, ".gitignore", "*.log\n")
+
+	diff, err := getUnstagedDiff()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	picker := newHunkPicker(parseDiff(diff))
+
+	var labels []string
+	for _, unit := range picker.units {
+		labels = append(labels, picker.label(unit))
+	}
+
+	want := []string{"main.go hunk 1/1 (+2 -0)", ".gitignore (+1 -0)", "docs/new.md (+1 -0)", "empty.txt (+0 -0)"}
+	if strings.Join(labels, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("labels = %q, want %q", labels, want)
+	}
+
+	// Stage everything but the ignore file
+	for i := range picker.units {
+		picker.selected[i] = i != 1
+	}
+
+	dir := t.TempDir()
+	patch := filepath.Join(dir, "selection.patch")
+	if err := os.WriteFile(patch, []byte(picker.patch()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	runGit(t, "apply", "--cached", patch)
+
+	if got := runGit(t, "diff", "--cached", "--name-status"); got != "A\tdocs/new.md\nA\tempty.txt\nM\tmain.go\n" {
+		t.Errorf("staged = %q", got)
+	}
+}
+
+func TestPickerFromSubdirectory(t *testing.T) {
+	dir := testRepo(t)
+
+	writeFile(t, "main.go", "package main\n")
+	runGit(t, "add", ".")
+	runGit(t, "commit", "-q", "-m", "chore: initial commit")
+
+	writeFile(t, "main.go", "package main\n\nfunc main() {}\n")
+	writeFile(t, "notes.txt", "notes\n")
+	writeFile(t, "docs/new.md", "# New\n")
+
+	if err := os.Chdir(filepath.Join(dir, "docs")); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := getUnstagedDiff()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	picker := newHunkPicker(parseDiff(diff))
+
+	var labels []string
+	for _, unit := range picker.units {
+		labels = append(labels, picker.label(unit))
+	}
+
+	// Untracked files outside of the current directory are listed relative to the root as well
+	want := []string{"main.go hunk 1/1 (+2 -0)", "docs/new.md (+1 -0)", "notes.txt (+1 -0)"}
+	if strings.Join(labels, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("labels = %q, want %q", labels, want)
+	}
+
+	for i := range picker.units {
+		picker.selected[i] = true
+	}
+
+	patch := filepath.Join(t.TempDir(), "selection.patch")
+	if err := os.WriteFile(patch, []byte(picker.patch()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	runGit(t, "-C", dir, "apply", "--cached", patch)
+
+	if got := runGit(t, "diff", "--cached", "--name-status"); got != "A\tdocs/new.md\nM\tmain.go\nA\tnotes.txt\n" {
+		t.Errorf("staged = %q", got)
+	}
+}
+
+func TestHighlightDiffLine(t *testing.T) {
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.TrueColor)
+	t.Cleanup(func() {
+		lipgloss.SetColorProfile(profile)
+	})
+
+	style := highlightStyle()
+
+	highlighter := newHighlighter("main.go", style)
+	if highlighter == nil {
+		t.Fatal("expected a highlighter for Go files")
+	}
+
+	for _, line := range []string{"+func main() {}", "-\treturn nil", " x := 1", "\\ No newline at end of file"} {
+		// Tabs are expanded by lipgloss either way
+		got := highlighter.line(line)
+		if want := ansi.Strip(colorDiffLine(line)); ansi.Strip(got) != want {
+			t.Errorf("line(%q) changes the text: %q, want %q", line, ansi.Strip(got), want)
+		}
+
+		if got == colorDiffLine(line) && !strings.HasPrefix(line, "\\") {
+			t.Errorf("line(%q) isn't highlighted", line)
+		}
+	}
+
+	// Files without a lexer are only colored as a diff
+	unknown := newHighlighter("file.unknown-extension", style)
+	if got := unknown.line("+text"); got != colorDiffLine("+text") {
+		t.Errorf("unknown file line = %q, want %q", got, colorDiffLine("+text"))
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+var previewPaneStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8")).Padding(0, 1)
+
+// A bubbletea model that shows a form on the left and a scrollable preview of the changes on the right
+type previewModel struct {
+	form  *huh.Form
+	diff  []string
+	files []string
+	// Show the list of changed files instead of the full diff
+	summary bool
+	scroll  int
+	width   int
+	height  int
+}
+
+func newPreviewModel(form *huh.Form, diff string) *previewModel {
+	files := parseDiff(diff)
+
+	var lines, summary []string
+	for _, file := range files {
+		for _, line := range strings.Split(strings.TrimSuffix(file.Patch(), "\n"), "\n") {
+			lines = append(lines, colorDiffLine(line))
+		}
+
+		for _, hunk := range file.Hunks {
+			lines = append(lines, colorDiffLine(hunk.Header))
+			for _, line := range hunk.Lines {
+				lines = append(lines, colorDiffLine(line))
+			}
+		}
+
+		added, removed := file.Stats()
+		summary = append(summary, fmt.Sprintf("%s %s %s", file.Path, diffAddedStyle.Render(fmt.Sprintf("+%d", added)), diffRemovedStyle.Render(fmt.Sprintf("-%d", removed))))
+	}
+
+	return &previewModel{
+		form:   form,
+		diff:   lines,
+		files:  summary,
+		width:  80,
+		height: 24,
+	}
+}
+
+func (m *previewModel) Init() tea.Cmd {
+	return m.form.Init()
+}
+
+func (m *previewModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.form = m.form.WithWidth(m.width / 2).WithHeight(m.height)
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+t":
+			m.summary = !m.summary
+			m.scroll = 0
+			return m, nil
+		case "pgdown":
+			m.scroll += m.paneHeight() / 2
+			return m, nil
+		case "pgup":
+			m.scroll = max(0, m.scroll-m.paneHeight()/2)
+			return m, nil
+		}
+	}
+
+	form, cmd := m.form.Update(msg)
+	if f, ok := form.(*huh.Form); ok {
+		m.form = f
+	}
+
+	if m.form.State != huh.StateNormal {
+		return m, tea.Quit
+	}
+
+	return m, cmd
+}
+
+// The number of lines available in the preview pane, leaving room for its border and help line
+func (m *previewModel) paneHeight() int {
+	return max(1, m.height-3)
+}
+
+func (m *previewModel) View() string {
+	if m.form.State != huh.StateNormal {
+		return ""
+	}
+
+	lines := m.diff
+	if m.summary {
+		lines = m.files
+	}
+
+	m.scroll = min(m.scroll, max(0, len(lines)-m.paneHeight()))
+	end := min(len(lines), m.scroll+m.paneHeight())
+
+	// Cut off long options of the form as well, instead of wrapping them onto the next line
+	form := strings.Split(m.form.View(), "\n")
+	for i, line := range form {
+		form[i] = ansi.Truncate(line, m.width/2, "…")
+	}
+
+	left := lipgloss.NewStyle().Width(m.width / 2).Render(strings.Join(form, "\n"))
+
+	// The width of the pane includes its padding but not its border.
+	// Long lines are cut off instead of wrapped so the layout stays intact.
+	width := max(10, m.width-lipgloss.Width(left)-2)
+	visible := make([]string, 0, end-m.scroll)
+	for _, line := range lines[m.scroll:end] {
+		visible = append(visible, ansi.Truncate(line, width-2, "…"))
+	}
+
+	pane := previewPaneStyle.Width(width).Height(m.paneHeight()).Render(strings.Join(visible, "\n"))
+	help := pickerHelpStyle.Render("ctrl+t toggle diff/files • pgup/pgdown scroll")
+
+	return lipgloss.JoinHorizontal(lipgloss.Top, left, lipgloss.JoinVertical(lipgloss.Left, pane, help))
+}
+
+// Run the form with a preview of the diff alongside it
+func runWithPreview(form *huh.Form, diff string) error {
+	model := newPreviewModel(form.WithShowHelp(true), diff)
+	if _, err := tea.NewProgram(model, tea.WithAltScreen()).Run(); err != nil {
+		return err
+	}
+
+	if model.form.State == huh.StateAborted {
+		return huh.ErrUserAborted
+	}
+
+	return nil
+}
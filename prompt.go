@@ -1,110 +1,136 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os/exec"
+	"regexp"
 	"strings"
-	"sync"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/segersniels/convit/generate"
 )
 
-const SYSTEM_MESSAGE string = `Generate a conventional commit message that follows the Conventional Commits specification as described below.
-A scope may be provided to a commit’s type, to provide additional contextual information and is contained within parenthesis, e.g., feat(parser): add ability to parse arrays.
-Base yourself on the adjusted files in the diff and the actual code changes to determine what the type and scope of the message should be.
-Don't include a message body, just the commit title (a single line). Don't surround it in backticks or anything of custom markdown formatting.`
+const SYSTEM_MESSAGE string = generate.DefaultSystemMessage
 
 const (
-	FULL_SUFFIX  = "You will be given a diff of the changes made to the codebase. You will need to generate a full commit message that includes the type, optional scope, and description of the changes."
-	SHORT_SUFFIX = "It is your job to come up with only the type and optional scope based on the provided commit message and staged changes (diff) and then reply with the full commit message. Don't touch the original provided commit message, just include it and don't add stuff to it."
+	SPLIT_SUFFIX = "You will be given a list of numbered hunks from the staged changes. Group the hunks into as few logical commits as makes sense (eg. a refactor, a fix and a documentation change) and generate a commit message for each group. Every hunk has to be part of exactly one group. Reply with only a JSON array, without any markdown formatting, in the form of [{\"message\": \"<commit message>\", \"hunks\": [<hunk numbers>]}] ordered in the way the commits should be made."
 )
 
-var FILES_TO_IGNORE = []string{
-	"package-lock.json",
-	"yarn.lock",
-	"npm-debug.log",
-	"yarn-debug.log",
-	"yarn-error.log",
-	".pnpm-debug.log",
-	"Cargo.lock",
-	"Gemfile.lock",
-	"mix.lock",
-	"Pipfile.lock",
-	"composer.lock",
-	"go.sum",
-}
+// Matches ticket references in branch names, eg. `ABC-123` in `feature/abc-123-login-page`
+var ticketPattern = regexp.MustCompile(`(?i)\b([a-z][a-z0-9]+-\d+)\b`)
 
-func splitDiffIntoChunks(diff string) []string {
-	split := strings.Split(diff, "diff --git")[1:]
-	for i, chunk := range split {
-		split[i] = strings.TrimSpace(chunk)
+// The ticket referenced in the name of the current branch, if any
+func ticketFromBranch(branch string) string {
+	match := ticketPattern.FindStringSubmatch(branch)
+	if match == nil {
+		return ""
 	}
 
-	return split
+	return strings.ToUpper(match[1])
 }
 
-func removeLockFiles(chunks []string) []string {
-	var wg sync.WaitGroup
-
-	filtered := make(chan string)
+// The commit types in the form the generator expects them
+func generatorTypes() []generate.CommitType {
+	types := make([]generate.CommitType, 0, len(CommitTypes))
+	for _, ct := range CommitTypes {
+		types = append(types, generate.CommitType{Type: ct.Type, Description: ct.Description})
+	}
 
-	for _, chunk := range chunks {
-		wg.Add(1)
+	return types
+}
 
-		go func(chunk string) {
-			defer wg.Done()
-			shouldIgnore := false
-			header := strings.Split(chunk, "\n")[0]
+// The configured maximum length of generated subjects, zero when there is no limit
+func maxSubjectLength() int {
+	switch length := CONFIG.Data.MaxSubjectLength; {
+	case length < 0:
+		return 0
+	case length == 0:
+		return DefaultMaxSubjectLength
+	default:
+		return length
+	}
+}
 
-			// Check if the first line contains any of the files to ignore
-			for _, file := range FILES_TO_IGNORE {
-				if strings.Contains(header, file) {
-					shouldIgnore = true
-				}
-			}
+// Create a generator for the provider and diff based on the user's configuration. The provider is nil when
+// only the prompt is rendered. When a message is provided, only the type and scope are generated. The examples
+// are looked up beforehand (see historyExamplesForDiff) so it doesn't count towards the timeout of a request.
+func newGenerator(provider *Provider, diff string, msg *string, examples []string) *generate.Generator {
+	paths := diffPaths(diff)
+	constraints := pathConstraints(paths)
+
+	options := generate.Options{
+		SystemMessage: CONFIG.Data.GenerateSystemMessage,
+		Types:         generatorTypes(),
+		// In a monorepo the model picks the scope from the packages that changed
+		Scopes:         touchedPackages(workspacePackages(), paths),
+		Type:           constraints.Type,
+		Scope:          constraints.Scope,
+		Examples:       examples,
+		SystemTemplate: CONFIG.Data.SystemTemplate,
+		PromptTemplate: CONFIG.Data.PromptTemplate,
+		Structured:     true,
+		// Generated messages are formatted the same way as the ones entered by the user
+		LowerCaseFirstLetter: CONFIG.Data.LowerCaseFirstLetter,
+		MaxSubjectLength:     maxSubjectLength(),
+	}
 
-			if !shouldIgnore {
-				filtered <- chunk
-			}
-		}(chunk)
+	// A detached HEAD has no branch, which is fine
+	if branch, err := gitOutput("branch", "--show-current"); err == nil {
+		options.Branch = branch
+		options.Ticket = ticketFromBranch(branch)
 	}
 
-	go func() {
-		wg.Wait()
-		close(filtered)
-	}()
+	if msg != nil {
+		options.Message = *msg
+	}
 
-	var result []string
-	for chunk := range filtered {
-		result = append(result, chunk)
+	var client MessageClient
+	if provider != nil {
+		client = provider.client
+		options.Raw = provider.raw
 	}
 
-	return result
+	return generate.NewGenerator(client, options)
 }
 
-// Split the diff in chunks and remove any lock files to save on tokens
-func prepareDiff(diff string) string {
-	chunks := splitDiffIntoChunks(diff)
+// Print the system message and prompt that would be sent to the model for the staged changes
+func (c *Convit) RenderPrompt(ctx context.Context, msg string) error {
+	diff, err := getStagedChanges()
+	if err != nil && !errors.Is(err, ErrNoStagedChanges) {
+		return err
+	}
 
-	return strings.Join(removeLockFiles(chunks), "\n")
-}
+	var partial *string
+	if msg != "" {
+		partial = &msg
+	}
 
-func prepareSystemMessage(partial bool) string {
-	examples := "Example of the types with the description when they should be used:\n"
-	for _, ct := range CommitTypes {
-		examples += fmt.Sprintf("- %s: %s\n", ct.Type, ct.Description)
+	generator := newGenerator(nil, diff, partial, historyExamplesForDiff(ctx, diff))
+
+	system, err := generator.SystemMessage(diff)
+	if err != nil {
+		return newValidationError(err.Error())
 	}
 
-	// If a partial generation is requested make sure we explicitly mention that we only want the type and scope
-	suffix := FULL_SUFFIX
-	if partial {
-		suffix = SHORT_SUFFIX
+	prompt, err := generator.Prompt(diff)
+	if err != nil {
+		return newValidationError(err.Error())
 	}
 
-	return fmt.Sprintf("%s\n\n%s\n\n%s", CONFIG.Data.GenerateSystemMessage, examples, suffix)
+	title := lipgloss.NewStyle().Bold(true)
+	fmt.Printf("%s\n%s\n\n%s\n%s\n", title.Render("System message"), system, title.Render("Prompt"), prompt)
+
+	return nil
+}
+
+func prepareSplitSystemMessage() string {
+	return fmt.Sprintf("%s\n\n%s\n\n%s", CONFIG.Data.GenerateSystemMessage, generate.TypeExamples(generatorTypes()), SPLIT_SUFFIX)
 }
 
-func getStagedChanges() (string, error) {
-	cmd := exec.Command("git", "diff", "--cached")
+func getStagedChanges(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"diff", "--cached"}, args...)...)
 	stdout, err := cmd.Output()
 
 	if err != nil {
@@ -112,7 +138,7 @@ func getStagedChanges() (string, error) {
 	}
 
 	if len(stdout) == 0 {
-		return "", errors.New("no staged changes found")
+		return "", ErrNoStagedChanges
 	}
 
 	return string(stdout), nil
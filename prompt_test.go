@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestMaxSubjectLength(t *testing.T) {
+	tests := []struct {
+		configured int
+		want       int
+	}{
+		// Configs from before the option was added
+		{0, DefaultMaxSubjectLength},
+		{50, 50},
+		{-1, 0},
+	}
+
+	for _, tt := range tests {
+		useConfig(t, ConfigData{MaxSubjectLength: tt.configured})
+
+		if got := maxSubjectLength(); got != tt.want {
+			t.Errorf("maxSubjectLength() with %d configured = %d, want %d", tt.configured, got, tt.want)
+		}
+	}
+}
@@ -1,40 +1,107 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"time"
+)
+
+// The default time a provider gets to reply, unless configured otherwise
+const DefaultProviderTimeout = 30 * time.Second
 
-	"github.com/charmbracelet/log"
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderFake      = "fake"
 )
 
 type Provider struct {
-	client MessageClient
+	name    string
+	model   string
+	client  MessageClient
+	timeout time.Duration
+	// Replies are used as is instead of being sanitized, eg. the echo of the fake provider
+	raw bool
 }
 
-func NewProvider(model string) *Provider {
+// The model to generate with, `CONVIT_MODEL` takes precedence over the configured one
+func generateModel() string {
+	if model := os.Getenv("CONVIT_MODEL"); model != "" {
+		return model
+	}
+
+	return CONFIG.Data.GenerateModel
+}
+
+// The provider serving the model
+func providerForModel(model string) string {
+	switch model {
+	case FakeModel:
+		return ProviderFake
+	case Claude3Dot5Sonnet:
+		return ProviderAnthropic
+	default:
+		return ProviderOpenAI
+	}
+}
+
+// Create the provider with the given name for the model, the name is derived from the model when empty
+func NewProvider(name, model string) (*Provider, error) {
 	var (
 		client MessageClient
 		apiKey string
+		raw    bool
 	)
 
-	// Depending on the user selected model, we need to set the corresponding API key
-	switch model {
-	case Claude3Dot5Sonnet:
+	if name == "" {
+		name = providerForModel(model)
+	}
+
+	// Depending on the provider, we need to set the corresponding API key
+	switch name {
+	case ProviderFake:
+		fixtures, err := loadFakeFixtures(os.Getenv("CONVIT_FAKE_FIXTURES"))
+		if err != nil {
+			return nil, err
+		}
+
+		fake, err := NewFake(fixtures)
+		if err != nil {
+			return nil, err
+		}
+
+		client = fake
+		raw = fixtures.Echo
+	case ProviderAnthropic:
 		apiKey = os.Getenv("ANTHROPIC_API_KEY")
-		if apiKey == "" {
-			log.Fatal("ANTHROPIC_API_KEY is not set")
+		if apiKey == "" && !recording() {
+			return nil, newAuthError(errors.New("ANTHROPIC_API_KEY is not set"))
 		}
 
-		client = NewAnthropic(apiKey, model)
-	default:
+		client = NewAnthropic(apiKey, model, modelParameters(model), os.Getenv("ANTHROPIC_BASE_URL"), newHTTPClient())
+	case ProviderOpenAI:
 		apiKey = os.Getenv("OPENAI_API_KEY")
-		if apiKey == "" {
-			log.Fatal("OPENAI_API_KEY is not set")
+		if apiKey == "" && !recording() {
+			return nil, newAuthError(errors.New("OPENAI_API_KEY is not set"))
 		}
 
-		client = NewOpenAI(apiKey, model)
+		client = NewOpenAI(apiKey, model, modelParameters(model), os.Getenv("OPENAI_BASE_URL"), newHTTPClient())
+	default:
+		return nil, fmt.Errorf("unknown provider: %s", name)
+	}
+
+	// Allow slower providers or models to be given more time
+	timeout := DefaultProviderTimeout
+	if seconds, ok := CONFIG.Data.ProviderTimeouts[name]; ok && seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
 	}
 
 	return &Provider{
-		client,
-	}
+		name,
+		model,
+		newRecordingClient(client, model, name),
+		timeout,
+		raw,
+	}, nil
 }
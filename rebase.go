@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// Quote a value so it can safely be used as a single shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Rewrite the messages of one or more commits through a scripted, non-interactive rebase.
+// `from` is the oldest commit being rewritten; it and every commit after it up to HEAD are replayed.
+// Commits without an entry in `messages` keep their original message.
+// If anything goes wrong the rebase is aborted and the original history is restored.
+func rebaseWithMessages(from string, messages map[string]string, opts CommitOptions) error {
+	if _, err := gitOutput("merge-base", "--is-ancestor", from, "HEAD"); err != nil {
+		return fmt.Errorf("commit %s is not part of the current branch", from)
+	}
+
+	// Rebasing onto the parent of the oldest commit, or from the root if it doesn't have one
+	onto := "--root"
+	revs := "HEAD"
+	if parent, err := gitOutput("rev-parse", "--verify", "--quiet", from+"^"); err == nil && parent != "" {
+		onto = parent
+		revs = parent + "..HEAD"
+	}
+
+	// A plain rebase flattens merges, so refuse instead of silently rewriting the topology
+	merges, err := gitOutput("rev-list", "--merges", revs)
+	if err != nil {
+		return err
+	}
+
+	if merges != "" {
+		return errors.New("cannot rewrite history that contains merge commits")
+	}
+
+	list, err := gitOutput("rev-list", "--reverse", revs)
+	if err != nil {
+		return err
+	}
+
+	warnAboutSignatures(revs, opts)
+
+	// Picked commits are only signed again when asked to, the same way as the amended ones
+	rebase := []string{"rebase", "--interactive", "--autostash"}
+	if opts.GPGSign {
+		rebase = append(rebase, "--gpg-sign")
+	}
+
+	dir, err := os.MkdirTemp("", "convit-rebase-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// Each rewritten commit is picked as is and then amended with its new message
+	opts.Amend = true
+	opts.Extra = append(opts.Extra, "--allow-empty")
+
+	var amend []string
+	for _, arg := range opts.args() {
+		amend = append(amend, shellQuote(arg))
+	}
+
+	var todo strings.Builder
+	for _, sha := range strings.Fields(list) {
+		fmt.Fprintf(&todo, "pick %s\n", sha)
+
+		msg, ok := messages[sha]
+		if !ok {
+			continue
+		}
+
+		file := filepath.Join(dir, sha)
+		if err := os.WriteFile(file, []byte(msg), 0o600); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(&todo, "exec git commit %s -F %s\n", strings.Join(amend, " "), shellQuote(file))
+	}
+
+	script := filepath.Join(dir, "git-rebase-todo")
+	if err := os.WriteFile(script, []byte(todo.String()), 0o600); err != nil {
+		return err
+	}
+
+	// Instead of opening an editor, git copies our prepared todo list over its own
+	cmd := exec.Command("git", append(rebase, onto)...)
+	cmd.Env = append(os.Environ(), "GIT_SEQUENCE_EDITOR=cp "+shellQuote(script))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	log.Debug("Running rebase command", "command", cmd.String(), "todo", todo.String())
+
+	if err := cmd.Run(); err != nil {
+		if abortErr := exec.Command("git", "rebase", "--abort").Run(); abortErr != nil {
+			log.Debug("Failed to abort rebase", "error", abortErr)
+		}
+
+		return fmt.Errorf("rebase failed, history has been restored: %v", err)
+	}
+
+	return nil
+}
+
+// Replaying commits drops their signatures, so warn when signed commits would lose theirs because
+// neither `--gpg-sign` nor `commit.gpgsign` is set
+func warnAboutSignatures(revs string, opts CommitOptions) {
+	if opts.GPGSign {
+		return
+	}
+
+	if sign, err := gitOutput("config", "--bool", "commit.gpgsign"); err == nil && sign == "true" {
+		return
+	}
+
+	// Signed commits that can't be verified (eg. without gpg installed) are still reported as something other than N
+	statuses, err := gitOutput("log", "--format=%G?", revs)
+	if err != nil {
+		log.Debug("Failed to check commit signatures", "error", err)
+		return
+	}
+
+	for _, status := range strings.Fields(statuses) {
+		if status != "N" {
+			log.Warn("The rewritten commits will no longer be signed, pass --gpg-sign to sign them again")
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Let the fake provider reply with the response for every request
+func fakeResponse(t *testing.T, response string) {
+	t.Helper()
+
+	fixtures := filepath.Join(t.TempDir(), "fixtures.json")
+	if err := os.WriteFile(fixtures, []byte(`{"default": "`+response+`"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CONVIT_FAKE_FIXTURES", fixtures)
+	t.Setenv("CONVIT_MODEL", FakeModel)
+	testHome(t)
+	useConfig(t, ConfigData{GenerateModel: FakeModel, GenerateSystemMessage: SYSTEM_MESSAGE, MaxSubjectLength: DefaultMaxSubjectLength})
+}
+
+func TestRewordKeepsBreakingChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		partial  bool
+		response string
+		want     string
+	}{
+		{"generated", false, "feat(api): remove the v1 endpoints", "feat(api)!: remove the v1 endpoints\n\nClients have to move to v2."},
+		{"partial", true, "feat(x): drop the v1 endpoints", "feat(x)!: drop the v1 endpoints\n\nClients have to move to v2."},
+		{"already marked", false, "feat(api)!: remove the v1 endpoints", "feat(api)!: remove the v1 endpoints\n\nClients have to move to v2."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeResponse(t, tt.response)
+			testRepo(t)
+			confirmMessages(t, true)
+
+			writeFile(t, "api.go", "package api\n")
+			runGit(t, "add", ".")
+			runGit(t, "commit", "-q", "-m", "feat(x)!: drop the v1 endpoints\n\nClients have to move to v2.")
+
+			if err := NewConvit().Amend(context.Background(), true, tt.partial, CommitOptions{}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.TrimSpace(runGit(t, "log", "-1", "--format=%B")); got != tt.want {
+				t.Errorf("message = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRebaseSignsPickedCommits(t *testing.T) {
+	testRepo(t)
+
+	// A stand-in for gpg that signs anything
+	gpg := filepath.Join(t.TempDir(), "gpg")
+	script := "#!/bin/sh\ncat > /dev/null\necho '[GNUPG:] SIG_CREATED ' >&2\nprintf -- '-----BEGIN PGP SIGNATURE-----\\n\\nfake\\n-----END PGP SIGNATURE-----\\n'\n"
+	if err := os.WriteFile(gpg, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	runGit(t, "config", "gpg.program", gpg)
+	runGit(t, "config", "user.signingkey", "convit@example.com")
+
+	for _, name := range []string{"a", "b", "c"} {
+		writeFile(t, name+".txt", name+"\n")
+		runGit(t, "add", ".")
+		runGit(t, "commit", "-q", "-S", "-m", "add "+name)
+	}
+
+	first := strings.TrimSpace(runGit(t, "rev-parse", "HEAD~2"))
+	if err := rebaseWithMessages(first, map[string]string{first: "feat: add a"}, CommitOptions{GPGSign: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both the reworded commit and the ones picked after it are signed again
+	for _, rev := range []string{"HEAD~2", "HEAD~1", "HEAD"} {
+		if !strings.Contains(runGit(t, "cat-file", "commit", rev), "gpgsig ") {
+			t.Errorf("%s isn't signed", rev)
+		}
+	}
+
+	if got := strings.TrimSpace(runGit(t, "log", "-1", "--format=%s", "HEAD~2")); got != "feat: add a" {
+		t.Errorf("subject = %q", got)
+	}
+}
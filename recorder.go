@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// A recorded request along with the response the provider replied with
+type cassette struct {
+	Method   string              `json:"method"`
+	URL      string              `json:"url"`
+	Request  string              `json:"request"`
+	Status   int                 `json:"status"`
+	Headers  map[string][]string `json:"headers"`
+	Response string              `json:"response"`
+}
+
+// Replays responses that were recorded before and records the ones that weren't,
+// so provider traffic can be reproduced offline without hitting the real endpoints
+type recorder struct {
+	dir       string
+	transport http.RoundTripper
+}
+
+// Response headers worth keeping, the rest (eg. request ids or cookies) would only add noise
+var recordedHeaders = []string{"Content-Type"}
+
+// The http client used to talk to the providers. When `CONVIT_RECORD` is set to a directory
+// the traffic is recorded to and replayed from that directory.
+func newHTTPClient() *http.Client {
+	dir := os.Getenv("CONVIT_RECORD")
+	if dir == "" {
+		return http.DefaultClient
+	}
+
+	return &http.Client{
+		Transport: &recorder{dir, http.DefaultTransport},
+	}
+}
+
+// Whether provider traffic is recorded and replayed. Replaying doesn't need an API key since
+// headers aren't part of the cassettes.
+func recording() bool {
+	return os.Getenv("CONVIT_RECORD") != ""
+}
+
+// The name of the cassette for a request. Headers are left out on purpose so API keys never
+// end up on disk and recordings can be replayed without one.
+func cassetteName(method, url string, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", method, url)
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))[:16] + ".json"
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading request body: %v", err)
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	path := filepath.Join(r.dir, cassetteName(req.Method, req.URL.String(), body))
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var c cassette
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("error parsing cassette %s: %v", path, err)
+		}
+
+		return c.response(req), nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error reading cassette %s: %v", path, err)
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Errors (eg. a missing API key or rate limits) are passed on but not recorded, so they
+	// don't end up being replayed forever
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %v", err)
+	}
+
+	c := cassette{
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Request:  string(body),
+		Status:   resp.StatusCode,
+		Headers:  map[string][]string{},
+		Response: string(content),
+	}
+
+	for _, header := range recordedHeaders {
+		if values := resp.Header.Values(header); len(values) > 0 {
+			c.Headers[header] = values
+		}
+	}
+
+	if err := c.save(path); err != nil {
+		return nil, err
+	}
+
+	return c.response(req), nil
+}
+
+func (c *cassette) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling cassette: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating cassette directory: %v", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing cassette %s: %v", path, err)
+	}
+
+	return nil
+}
+
+func (c *cassette) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.Status, http.StatusText(c.Status)),
+		StatusCode:    c.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header(c.Headers),
+		Body:          io.NopCloser(bytes.NewBufferString(c.Response)),
+		ContentLength: int64(len(c.Response)),
+		Request:       req,
+	}
+}
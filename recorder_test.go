@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	status := http.StatusTooManyRequests
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "req_123")
+		w.WriteHeader(status)
+		io.WriteString(w, `{"reply": "hello"}`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	t.Setenv("CONVIT_RECORD", dir)
+	client := newHTTPClient()
+
+	post := func() (int, string) {
+		t.Helper()
+
+		resp, err := client.Post(server.URL+"/v1/messages", "application/json", strings.NewReader(`{"prompt": "hi"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return resp.StatusCode, string(body)
+	}
+
+	// Errors are passed on without being recorded
+	if code, _ := post(); code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("recorded %d cassettes for an error, want none", len(entries))
+	}
+
+	status = http.StatusOK
+	if code, body := post(); code != http.StatusOK || body != `{"reply": "hello"}` {
+		t.Errorf("response = %d %q", code, body)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("recorded %d cassettes, want 1 (%v)", len(entries), err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "req_123") {
+		t.Errorf("cassette contains headers that shouldn't be recorded:\n%s", data)
+	}
+
+	// The same request is replayed from the cassette from now on
+	status = http.StatusInternalServerError
+	if code, body := post(); code != http.StatusOK || body != `{"reply": "hello"}` {
+		t.Errorf("replayed response = %d %q", code, body)
+	}
+
+	if requests != 2 {
+		t.Errorf("server got %d requests, want 2", requests)
+	}
+}
+
+func TestNewProviderWithoutAPIKey(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+
+	t.Setenv("CONVIT_RECORD", "")
+	if _, err := NewProvider(ProviderOpenAI, GPT4oMini); err == nil {
+		t.Error("expected an error without an API key")
+	}
+
+	// Replaying recorded traffic doesn't need one
+	t.Setenv("CONVIT_RECORD", t.TempDir())
+	if _, err := NewProvider(ProviderOpenAI, GPT4oMini); err != nil {
+		t.Errorf("unexpected error when replaying: %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/charmbracelet/log"
+	"github.com/segersniels/convit/conventional"
+)
+
+// A commit on the branch that is being rewritten
+type rewriteEntry struct {
+	sha     string
+	subject string
+	body    string
+	// The suggested replacement message, empty when the commit is kept as is
+	message string
+}
+
+// Resolve a `<base>..HEAD` range (or just `<base>`) to the commits in it, oldest first.
+// Since the commits are rewritten through a rebase the range has to end at HEAD.
+func listCommitsToRewrite(spec string) ([]string, error) {
+	base, tip, found := strings.Cut(spec, "..")
+	if found && tip != "" {
+		head, err := resolveCommit("HEAD")
+		if err != nil {
+			return nil, err
+		}
+
+		sha, err := resolveCommit(tip)
+		if err != nil {
+			return nil, err
+		}
+
+		if sha != head {
+			return nil, errors.New("the range to rewrite has to end at HEAD")
+		}
+	}
+
+	if _, err := resolveCommit(base); err != nil {
+		return nil, err
+	}
+
+	list, err := gitOutput("rev-list", "--reverse", base+"..HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(list), nil
+}
+
+// Render the rewrite plan as a table so the user can review it in one go
+func renderRewritePlan(entries []rewriteEntry) string {
+	cell := lipgloss.NewStyle().Padding(0, 1)
+	faint := lipgloss.NewStyle().Faint(true)
+
+	t := table.New().
+		Border(lipgloss.RoundedBorder()).
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if row == 0 {
+				return cell.Bold(true)
+			}
+
+			return cell
+		}).
+		Headers("Commit", "Original", "New")
+
+	for _, entry := range entries {
+		suggestion := faint.Render("unchanged")
+		if entry.message != "" {
+			suggestion, _, _ = strings.Cut(entry.message, "\n")
+		}
+
+		t.Row(entry.sha[:7], entry.subject, suggestion)
+	}
+
+	return t.Render()
+}
+
+// Ask the user for an edited message, an empty one means the original message is kept.
+// Replaced in tests, where there is no terminal to answer it.
+var editMessage = func(msg, description string) (string, error) {
+	err := huh.NewText().
+		Title("Edit the commit message").
+		Description(description).
+		Value(&msg).
+		Validate(func(value string) error {
+			if strings.TrimSpace(value) == "" {
+				return nil
+			}
+
+			_, err := conventional.Parse(value)
+			return err
+		}).
+		Run()
+
+	return strings.TrimSpace(msg), err
+}
+
+// Go over the suggestions one by one, letting the user accept, edit or skip each of them
+func reviewRewritePlan(entries []rewriteEntry) error {
+	for i, entry := range entries {
+		if entry.message == "" {
+			continue
+		}
+
+		description := fmt.Sprintf("Replaces %q (%s). Do you want to use this message?", entry.subject, entry.sha[:7])
+		accepted, err := confirmMessage(entry.message, description)
+		if err != nil {
+			return err
+		}
+
+		if accepted {
+			continue
+		}
+
+		entries[i].message, err = editMessage(entry.message, fmt.Sprintf("Replaces %q (%s). Leave empty to skip the commit.", entry.subject, entry.sha[:7]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Suggest conventional messages for every non-conventional commit in the range and apply them after review
+func (c *Convit) Rewrite(ctx context.Context, spec string, opts CommitOptions) error {
+	shas, err := listCommitsToRewrite(spec)
+	if err != nil {
+		return err
+	}
+
+	if len(shas) == 0 {
+		return newNoChangesError("no commits found to rewrite")
+	}
+
+	entries := make([]rewriteEntry, 0, len(shas))
+	pending := 0
+	for _, sha := range shas {
+		subject, body, err := getCommitMessage(sha)
+		if err != nil {
+			return err
+		}
+
+		if !isConventional(subject) {
+			pending++
+		}
+
+		entries = append(entries, rewriteEntry{sha: sha, subject: subject, body: body})
+	}
+
+	if pending == 0 {
+		log.Info("All commits are already conventional")
+		return nil
+	}
+
+	if err := prepareCommitIndex(ctx); err != nil {
+		return err
+	}
+
+	chain := NewProviderChain()
+
+	if err := runWithSpinner(ctx, fmt.Sprintf("Generating messages for %d commits...", pending), func(ctx context.Context) error {
+		for i, entry := range entries {
+			if isConventional(entry.subject) {
+				continue
+			}
+
+			diff, err := getCommitDiff(entry.sha)
+			if err != nil {
+				// Commits without changes (eg. empty commits) are left untouched
+				log.Debug("Skipping commit", "sha", entry.sha, "error", err)
+				continue
+			}
+
+			examples := historyExamplesForDiff(ctx, diff)
+
+			var response string
+			if _, err := chain.run(ctx, func(ctx context.Context, provider *Provider) error {
+				var err error
+				response, err = c.request(ctx, provider, diff, false, nil, examples)
+				return err
+			}); err != nil {
+				return err
+			}
+
+			response = strings.TrimSpace(response)
+			if response == "" {
+				return fmt.Errorf("failed to generate commit message for %s", entry.sha[:7])
+			}
+
+			// Keep the original body of the commit
+			if entry.body != "" {
+				response = fmt.Sprintf("%s\n\n%s", response, entry.body)
+			}
+
+			entries[i].message = response
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	fmt.Println(renderRewritePlan(entries))
+
+	if err := reviewRewritePlan(entries); err != nil {
+		return err
+	}
+
+	// Only the commits from the first rewritten one onwards need to be replayed
+	var from string
+	messages := make(map[string]string)
+	for _, entry := range entries {
+		if entry.message == "" {
+			continue
+		}
+
+		if from == "" {
+			from = entry.sha
+		}
+
+		messages[entry.sha] = entry.message
+	}
+
+	if from == "" {
+		log.Info("Nothing to rewrite")
+		return nil
+	}
+
+	return rebaseWithMessages(from, messages, opts)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// Answer the edits of rejected messages in order, returning the messages that were edited
+func editMessages(t *testing.T, answers ...string) *[]string {
+	t.Helper()
+
+	var edited []string
+	original := editMessage
+	editMessage = func(msg, description string) (string, error) {
+		edited = append(edited, msg)
+		if len(edited) > len(answers) {
+			t.Fatalf("unexpected edit of %q", msg)
+		}
+
+		return answers[len(edited)-1], nil
+	}
+
+	t.Cleanup(func() {
+		editMessage = original
+	})
+
+	return &edited
+}
+
+func TestRewriteReviewsEachCommit(t *testing.T) {
+	fakeResponse(t, "feat: add a suggested change")
+	testRepo(t)
+
+	writeFile(t, "base.txt", "base\n")
+	runGit(t, "add", ".")
+	runGit(t, "commit", "-q", "-m", "chore: initial commit")
+
+	for _, name := range []string{"accepted", "edited", "skipped"} {
+		writeFile(t, name+".txt", name+"\n")
+		runGit(t, "add", ".")
+		runGit(t, "commit", "-q", "-m", "wip "+name+"\n\nThe body of "+name)
+	}
+
+	shown := confirmMessages(t, true, false, false)
+	edited := editMessages(t, "fix: an edited message\n\nThe body of edited", "")
+
+	if err := NewConvit().Rewrite(context.Background(), "HEAD~3..HEAD", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*shown) != 3 || len(*edited) != 2 || (*edited)[0] != "feat: add a suggested change\n\nThe body of edited" {
+		t.Errorf("confirmed %q and edited %q", *shown, *edited)
+	}
+
+	got := strings.Split(strings.Trim(runGit(t, "log", "--format=%B%x00", "HEAD~3..HEAD"), "\x00\n"), "\x00")
+	for i := range got {
+		got[i] = strings.TrimSpace(got[i])
+	}
+
+	want := []string{
+		"wip skipped\n\nThe body of skipped",
+		"fix: an edited message\n\nThe body of edited",
+		"feat: add a suggested change\n\nThe body of accepted",
+	}
+
+	if strings.Join(got, "\n--\n") != strings.Join(want, "\n--\n") {
+		t.Errorf("messages =\n%s\nwant\n%s", strings.Join(got, "\n--\n"), strings.Join(want, "\n--\n"))
+	}
+}
+
+func TestRewriteEverythingSkipped(t *testing.T) {
+	fakeResponse(t, "feat: add a suggested change")
+	testRepo(t)
+
+	writeFile(t, "a.txt", "a\n")
+	runGit(t, "add", ".")
+	runGit(t, "commit", "-q", "-m", "chore: initial commit")
+
+	writeFile(t, "b.txt", "b\n")
+	runGit(t, "add", ".")
+	runGit(t, "commit", "-q", "-m", "wip")
+
+	head := runGit(t, "rev-parse", "HEAD")
+
+	confirmMessages(t, false)
+	editMessages(t, "")
+
+	if err := NewConvit().Rewrite(context.Background(), "HEAD~1", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := runGit(t, "rev-parse", "HEAD"); got != head {
+		t.Error("history was rewritten while every commit was skipped")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// A convention that changes to files matching the pattern always use the given type and/or scope,
+// eg. everything under `services/billing/**` gets the `billing` scope
+type PathRule struct {
+	Pattern string `json:"pattern"`
+	Type    string `json:"type,omitempty"`
+	Scope   string `json:"scope,omitempty"`
+}
+
+// The type and scope a commit has to use, empty when it is free to pick one
+type Constraints struct {
+	Type  string
+	Scope string
+}
+
+// Convert a glob to a regular expression. `*` matches within a single directory,
+// `**` matches across directories and `?` matches a single character.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+		case pattern[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+// Match a file against a glob. Patterns without a slash are matched against the file name only.
+func matchGlob(pattern, file string) bool {
+	if !strings.Contains(pattern, "/") {
+		file = path.Base(file)
+	}
+
+	re, err := globRegexp(pattern)
+	if err != nil {
+		log.Debug("Invalid glob", "pattern", pattern, "error", err)
+		return false
+	}
+
+	return re.MatchString(file)
+}
+
+// Find the type and scope the files have to use according to the configured path rules. For every file
+// the first matching rule applies. A type or scope is only enforced when the rules of all files agree on it,
+// so a change that also touches files without a rule is left unconstrained.
+func pathConstraints(files []string) Constraints {
+	var types, scopes []string
+	for _, file := range files {
+		var matched PathRule
+		for _, rule := range CONFIG.Data.PathRules {
+			if matchGlob(rule.Pattern, file) {
+				matched = rule
+				break
+			}
+		}
+
+		types = append(types, matched.Type)
+		scopes = append(scopes, matched.Scope)
+	}
+
+	return Constraints{
+		Type:  agreedConstraint("type", types),
+		Scope: agreedConstraint("scope", scopes),
+	}
+}
+
+// The value every file has to use, empty when a file is free to pick one or the files disagree
+func agreedConstraint(name string, values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	for _, value := range values {
+		if value == "" {
+			if slices.ContainsFunc(values, func(v string) bool { return v != "" }) {
+				log.Debug("Not every file has a path rule for the "+name+", leaving it unconstrained", "values", values)
+			}
+
+			return ""
+		}
+
+		if value != values[0] {
+			log.Debug("Path rules disagree on the "+name+", leaving it unconstrained", name, values[0], "other", value)
+			return ""
+		}
+	}
+
+	return values[0]
+}
+
+// The paths of the files changed in a diff
+func diffPaths(diff string) []string {
+	files := parseDiff(diff)
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+
+	return paths
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestPathConstraints(t *testing.T) {
+	useConfig(t, ConfigData{PathRules: []PathRule{
+		{Pattern: "services/billing/**", Scope: "billing"},
+		{Pattern: "docs/**", Type: "docs"},
+		{Pattern: "*.md", Type: "docs", Scope: "readme"},
+	}})
+
+	tests := []struct {
+		name  string
+		files []string
+		want  Constraints
+	}{
+		{"no files", nil, Constraints{}},
+		{"every file matches", []string{"services/billing/invoice.go", "services/billing/api/totals.go"}, Constraints{Scope: "billing"}},
+		{"some files match", []string{"services/billing/invoice.go", "main.go"}, Constraints{}},
+		{"first matching rule applies", []string{"docs/usage.md", "docs/api.txt"}, Constraints{Type: "docs"}},
+		{"rules agree on the type only", []string{"README.md", "docs/api.txt"}, Constraints{Type: "docs"}},
+		{"rules disagree", []string{"README.md", "services/billing/invoice.go"}, Constraints{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pathConstraints(tt.files); got != tt.want {
+				t.Errorf("pathConstraints(%q) = %+v, want %+v", tt.files, got, tt.want)
+			}
+		})
+	}
+}
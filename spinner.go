@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/huh/spinner"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/term"
+)
+
+// Run the action while showing a spinner. The context passed to the action is cancelled
+// when the user presses ctrl+c or the parent context is cancelled (eg. on SIGINT or SIGTERM).
+// Without a terminal (eg. in scripts) the action runs without a spinner.
+func runWithSpinner(ctx context.Context, title string, action func(ctx context.Context) error) error {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return action(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- action(ctx)
+
+		// Stops the spinner now that the action has finished
+		cancel()
+	}()
+
+	if err := spinner.New().TitleStyle(lipgloss.NewStyle()).Title(title).Context(ctx).Run(); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-done:
+		return err
+	default:
+		// The spinner stopped before the action finished, meaning the user pressed ctrl+c
+		cancel()
+		<-done
+
+		return huh.ErrUserAborted
+	}
+}
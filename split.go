@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/log"
+	"github.com/segersniels/convit/generate"
+)
+
+// A part of the staged changes that can be committed on its own, either a single hunk or an entire file
+type splitUnit struct {
+	file int
+	// The index of the hunk in the file, -1 when the unit covers the entire file
+	hunk int
+}
+
+// A group of units as suggested by the model
+type splitGroup struct {
+	Message string `json:"message"`
+	Hunks   []int  `json:"hunks"`
+}
+
+// A single commit of the split plan
+type splitCommit struct {
+	Message string   `json:"message"`
+	Files   []string `json:"files"`
+	Patch   string   `json:"patch"`
+}
+
+// The state of a split in progress, persisted so an interrupted split can be continued or aborted
+type splitState struct {
+	// The commit that was checked out before splitting, empty when there were no commits yet
+	Head string `json:"head"`
+	// The tree of the index before splitting
+	Tree    string        `json:"tree"`
+	Commits []splitCommit `json:"commits"`
+	Next    int           `json:"next"`
+}
+
+// Only plain modifications can safely be split up in separate hunks.
+// Renames, mode changes, new or deleted files are committed as a whole.
+func (f FileDiff) splittable() bool {
+	for _, line := range f.Header {
+		if !strings.HasPrefix(line, "diff --git ") && !strings.HasPrefix(line, "index ") && !strings.HasPrefix(line, "--- ") && !strings.HasPrefix(line, "+++ ") {
+			return false
+		}
+	}
+
+	return len(f.Hunks) > 0
+}
+
+func splitUnits(files []FileDiff) []splitUnit {
+	var units []splitUnit
+	for i, file := range files {
+		if !file.splittable() {
+			units = append(units, splitUnit{file: i, hunk: -1})
+			continue
+		}
+
+		for j := range file.Hunks {
+			units = append(units, splitUnit{file: i, hunk: j})
+		}
+	}
+
+	return units
+}
+
+// Describe the numbered units to the model, leaving out the contents of lock files to save on tokens
+func prepareSplitPrompt(files []FileDiff, units []splitUnit) string {
+	var b strings.Builder
+	for i, unit := range units {
+		file := files[unit.file]
+		fmt.Fprintf(&b, "hunk %d: %s\n", i+1, file.Path)
+
+		if slices.ContainsFunc(generate.DefaultIgnoredFiles, func(name string) bool { return strings.HasSuffix(file.Path, name) }) {
+			b.WriteString("(lock file)\n\n")
+			continue
+		}
+
+		if unit.hunk != -1 {
+			b.WriteString(file.Hunks[unit.hunk].String() + "\n")
+			continue
+		}
+
+		for _, line := range file.Header {
+			// Binary patches are of no use to the model
+			if strings.HasPrefix(line, "GIT binary patch") {
+				break
+			}
+
+			b.WriteString(line + "\n")
+		}
+
+		for _, hunk := range file.Hunks {
+			b.WriteString(hunk.String())
+		}
+
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// Parse the plan suggested by the model and turn it into commits, ensuring every unit is used exactly once
+func parseSplitPlan(response string, files []FileDiff, units []splitUnit) ([]splitCommit, error) {
+	start, end := strings.Index(response, "["), strings.LastIndex(response, "]")
+	if start == -1 || end < start {
+		return nil, errors.New("failed to find a plan in the response")
+	}
+
+	var groups []splitGroup
+	if err := json.Unmarshal([]byte(response[start:end+1]), &groups); err != nil {
+		return nil, fmt.Errorf("error decoding plan: %v", err)
+	}
+
+	seen := make(map[int]bool)
+	// Keep track of the hunks committed by earlier groups, since they shift the lines of the hunks after them
+	committed := make(map[splitUnit]bool)
+
+	var commits []splitCommit
+	for _, group := range groups {
+		if len(group.Hunks) == 0 {
+			continue
+		}
+
+		if strings.TrimSpace(group.Message) == "" {
+			return nil, errors.New("the suggested plan contains a commit without a message")
+		}
+
+		// Collect the selected hunks per file, in the order they appear in the diff
+		selected := make(map[int][]int)
+		for _, n := range group.Hunks {
+			if n < 1 || n > len(units) {
+				return nil, fmt.Errorf("the suggested plan refers to unknown hunk %d", n)
+			}
+
+			if seen[n] {
+				return nil, fmt.Errorf("the suggested plan uses hunk %d more than once", n)
+			}
+
+			seen[n] = true
+			unit := units[n-1]
+			selected[unit.file] = append(selected[unit.file], unit.hunk)
+		}
+
+		commit := splitCommit{Message: strings.TrimSpace(group.Message)}
+		for i, file := range files {
+			hunks, ok := selected[i]
+			if !ok {
+				continue
+			}
+
+			commit.Files = append(commit.Files, file.Path)
+
+			// Units covering an entire file include all of its hunks
+			if slices.Contains(hunks, -1) {
+				hunks = make([]int, len(file.Hunks))
+				for j := range hunks {
+					hunks[j] = j
+				}
+			}
+
+			slices.Sort(hunks)
+			commit.Patch += splitPatch(file, i, hunks, committed)
+		}
+
+		commits = append(commits, commit)
+	}
+
+	for i := range units {
+		if !seen[i+1] {
+			return nil, fmt.Errorf("the suggested plan doesn't include hunk %d", i+1)
+		}
+	}
+
+	return commits, nil
+}
+
+// Build the patch for the selected hunks of a file. Since the hunks are applied in a different order than they
+// appear in the diff, their line numbers are adjusted for the hunks that were already committed before them.
+// This prevents `git apply` from having to guess where a hunk belongs when the surrounding lines are ambiguous.
+func splitPatch(file FileDiff, index int, hunks []int, committed map[splitUnit]bool) string {
+	if !file.splittable() {
+		return file.Patch(hunks...)
+	}
+
+	patch := file.Patch()
+	shift := 0
+	for _, h := range hunks {
+		offset := 0
+		for j := 0; j < h; j++ {
+			if committed[splitUnit{file: index, hunk: j}] {
+				added, removed := file.Hunks[j].Stats()
+				offset += added - removed
+			}
+		}
+
+		start := file.Hunks[h].OldStart() + offset
+		patch += file.Hunks[h].Move(start, start+shift).String()
+
+		added, removed := file.Hunks[h].Stats()
+		shift += added - removed
+	}
+
+	for _, h := range hunks {
+		committed[splitUnit{file: index, hunk: h}] = true
+	}
+
+	return patch
+}
+
+// The location of the split state file inside the git directory
+func splitStatePath() (string, error) {
+	return gitOutput("rev-parse", "--git-path", "convit/split.json")
+}
+
+func loadSplitState() (*splitState, error) {
+	path, err := splitStatePath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var state splitState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+func (s *splitState) save() error {
+	path, err := splitStatePath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (s *splitState) remove() error {
+	path, err := splitStatePath()
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// Apply the remaining commits of the plan one by one, recording the progress after each commit
+func (s *splitState) run(opts CommitOptions) error {
+	dir, err := os.MkdirTemp("", "convit-split-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// Paths in the patches are relative to the root, applying them from a subdirectory would skip the ones outside of it
+	root, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+
+	for s.Next < len(s.Commits) {
+		commit := s.Commits[s.Next]
+
+		patch := filepath.Join(dir, fmt.Sprintf("%d.patch", s.Next))
+		if err := os.WriteFile(patch, []byte(commit.Patch), 0o600); err != nil {
+			return err
+		}
+
+		// When continuing after a failed commit the changes might already be staged
+		if err := exec.Command("git", "-C", root, "apply", "--cached", "--check", "--reverse", patch).Run(); err != nil {
+			cmd := exec.Command("git", "-C", root, "apply", "--cached", patch)
+			cmd.Stderr = os.Stderr
+
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf("failed to stage changes for %q: %v", commit.Message, err)
+			}
+		}
+
+		if err := gitCommit(commit.Message, opts); err != nil {
+			return err
+		}
+
+		s.Next++
+		if err := s.save(); err != nil {
+			return err
+		}
+	}
+
+	return s.remove()
+}
+
+// Restore the commit and index from before the split was started
+func (s *splitState) abort() error {
+	if s.Head != "" {
+		if err := exec.Command("git", "reset", "--quiet", "--soft", s.Head).Run(); err != nil {
+			return err
+		}
+	} else if err := exec.Command("git", "update-ref", "-d", "HEAD").Run(); err != nil {
+		return err
+	}
+
+	if err := exec.Command("git", "read-tree", s.Tree).Run(); err != nil {
+		return err
+	}
+
+	return s.remove()
+}
+
+// Let the user review and edit the messages of the plan
+func promptForSplitPlan(commits []splitCommit) (bool, error) {
+	groups := make([]*huh.Group, 0, len(commits)+1)
+	for i := range commits {
+		groups = append(groups, huh.NewGroup(
+			huh.NewInput().
+				Title(fmt.Sprintf("Commit %d of %d", i+1, len(commits))).
+				Description(strings.Join(commits[i].Files, "\n")).
+				Value(&commits[i].Message).
+				Validate(func(val string) error {
+					if strings.TrimSpace(val) == "" {
+						return errors.New("message cannot be empty")
+					}
+
+					return nil
+				}),
+		))
+	}
+
+	var confirmation bool
+	groups = append(groups, huh.NewGroup(
+		huh.NewConfirm().Title(fmt.Sprintf("Do you want to make these %d commits?", len(commits))).Value(&confirmation),
+	))
+
+	if err := huh.NewForm(groups...).Run(); err != nil {
+		return false, err
+	}
+
+	return confirmation, nil
+}
+
+// Split the staged changes into multiple logical commits with the help of AI
+func (c *Convit) Split(ctx context.Context, opts CommitOptions) error {
+	state, err := loadSplitState()
+	if err != nil {
+		return err
+	}
+
+	if state != nil {
+		return errors.New("a split is already in progress, use `convit split --continue` or `convit split --abort`")
+	}
+
+	diff, err := getStagedChanges("--binary")
+	if err != nil {
+		return err
+	}
+
+	files := parseDiff(diff)
+	units := splitUnits(files)
+	chain := NewProviderChain()
+
+	var commits []splitCommit
+	if err := runWithSpinner(ctx, "Grouping your changes...", func(ctx context.Context) error {
+		var response string
+		if _, err := chain.run(ctx, func(ctx context.Context, provider *Provider) error {
+			// Set a timeout for the request, giving the model some extra time since it has to reply with the entire plan
+			ctx, cancel := context.WithTimeout(ctx, 2*provider.timeout)
+			defer cancel()
+
+			var err error
+			response, _, err = provider.client.CreateMessage(ctx, prepareSplitSystemMessage(), prepareSplitPrompt(files, units))
+
+			return err
+		}); err != nil {
+			return err
+		}
+
+		var err error
+		commits, err = parseSplitPlan(response, files, units)
+
+		return err
+	}); err != nil {
+		return err
+	}
+
+	confirmation, err := promptForSplitPlan(commits)
+	if err != nil {
+		return err
+	}
+
+	if !confirmation {
+		return nil
+	}
+
+	tree, err := gitOutput("write-tree")
+	if err != nil {
+		return err
+	}
+
+	// There is no HEAD yet when splitting the initial commit
+	head, _ := gitOutput("rev-parse", "--verify", "--quiet", "HEAD")
+
+	state = &splitState{Head: head, Tree: tree, Commits: commits}
+	if err := state.save(); err != nil {
+		return err
+	}
+
+	// Unstage everything while leaving the working tree untouched
+	reset := exec.Command("git", "read-tree", "--empty")
+	if head != "" {
+		reset = exec.Command("git", "read-tree", head)
+	}
+
+	if err := reset.Run(); err != nil {
+		return err
+	}
+
+	return c.runSplit(state, opts)
+}
+
+// Continue a split that was interrupted
+func (c *Convit) ContinueSplit(opts CommitOptions) error {
+	state, err := loadSplitState()
+	if err != nil {
+		return err
+	}
+
+	if state == nil {
+		return errors.New("no split in progress")
+	}
+
+	return c.runSplit(state, opts)
+}
+
+// Abort a split that was interrupted and restore the original staged changes
+func (c *Convit) AbortSplit() error {
+	state, err := loadSplitState()
+	if err != nil {
+		return err
+	}
+
+	if state == nil {
+		return errors.New("no split in progress")
+	}
+
+	if err := state.abort(); err != nil {
+		return err
+	}
+
+	log.Info("Restored the staged changes from before the split")
+	return nil
+}
+
+func (c *Convit) runSplit(state *splitState, opts CommitOptions) error {
+	if err := state.run(opts); err != nil {
+		log.Error("Splitting was interrupted, run `convit split --continue` to resume or `convit split --abort` to restore your staged changes")
+		return err
+	}
+
+	return nil
+}
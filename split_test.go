@@ -0,0 +1,204 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitUnits(t *testing.T) {
+	units := splitUnits(parseDiff(multiHunkDiff))
+
+	// Only the modified file is split up, the new, deleted, binary and renamed files are committed as a whole
+	want := []splitUnit{{0, 0}, {0, 1}, {1, -1}, {2, -1}, {3, -1}, {4, -1}}
+	if !slices.Equal(units, want) {
+		t.Errorf("units = %v, want %v", units, want)
+	}
+}
+
+func TestParseSplitPlanErrors(t *testing.T) {
+	files := parseDiff(multiHunkDiff)
+	units := splitUnits(files)
+
+	tests := []struct {
+		name     string
+		response string
+		err      string
+	}{
+		{"no plan", "I can't do that", "failed to find a plan"},
+		{"invalid json", "[{]", "error decoding plan"},
+		{"unknown hunk", `[{"message": "feat: a", "hunks": [1, 2, 3, 4, 5, 6, 7]}]`, "unknown hunk 7"},
+		{"duplicate hunk", `[{"message": "feat: a", "hunks": [1, 2, 3]}, {"message": "fix: b", "hunks": [3, 4, 5, 6]}]`, "hunk 3 more than once"},
+		{"missing hunk", `[{"message": "feat: a", "hunks": [1, 2, 3, 4, 5]}]`, "doesn't include hunk 6"},
+		{"empty message", `[{"message": " ", "hunks": [1, 2, 3, 4, 5, 6]}]`, "without a message"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseSplitPlan(tt.response, files, units)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseSplitPlanGroupsFiles(t *testing.T) {
+	files := parseDiff(multiHunkDiff)
+	units := splitUnits(files)
+
+	response := "Here is the plan:\n```json\n" + `[
+		{"message": "docs: add new page", "hunks": [3]},
+		{"message": "feat: update main", "hunks": [2, 1, 4]},
+		{"message": "chore: update assets", "hunks": [5, 6]},
+		{"message": "empty", "hunks": []}
+	]` + "\n```"
+
+	commits, err := parseSplitPlan(response, files, units)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commits) != 3 {
+		t.Fatalf("got %d commits, want 3", len(commits))
+	}
+
+	want := [][]string{{"docs/new.md"}, {"main.go", "old.txt"}, {"logo.png", "after.go"}}
+	for i, commit := range commits {
+		if !slices.Equal(commit.Files, want[i]) {
+			t.Errorf("commit %d files = %q, want %q", i, commit.Files, want[i])
+		}
+	}
+
+	// The hunks are put back in the order they appear in the diff
+	if first, second := strings.Index(commits[1].Patch, "+added 1"), strings.Index(commits[1].Patch, "+changed 12"); first == -1 || first > second {
+		t.Errorf("hunks out of order:\n%s", commits[1].Patch)
+	}
+}
+
+// The same block of lines repeated, so `git apply` can't rely on the context to find where a hunk belongs
+func ambiguousLines(blocks int) []string {
+	var lines []string
+	for i := 0; i < blocks; i++ {
+		lines = append(lines, strings.Split("a b c d e f g h i j", " ")...)
+	}
+
+	return lines
+}
+
+func insertLines(lines []string, at int, inserted ...string) []string {
+	return slices.Insert(slices.Clone(lines), at, inserted...)
+}
+
+func joinLines(lines []string) string {
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestSplitCommitsHunksOutOfOrder(t *testing.T) {
+	dir := testRepo(t)
+
+	original := ambiguousLines(6)
+	writeFile(t, "same.txt", joinLines(original))
+	writeFile(t, "deleted.txt", "gone\n")
+	runGit(t, "add", ".")
+	runGit(t, "commit", "-q", "-m", "chore: initial commit")
+
+	// Three hunks in the same file: lines inserted at the top, a line changed in the middle and a line inserted at the end.
+	// The lines inserted at the top shift the middle hunk by more than half a block, so applying it at its original
+	// line would match the wrong block.
+	added := []string{"A1", "A2", "A3", "A4", "A5", "A6", "A7"}
+	changed := insertLines(original, 5, added...)
+	changed[37] = "B"
+	changed = insertLines(changed, 62, "C1")
+	writeFile(t, "same.txt", joinLines(changed))
+	writeFile(t, "new.txt", "new\n")
+	writeFile(t, "image.bin", "\x00\x01\x02binary\x00")
+	os.Remove("deleted.txt")
+	runGit(t, "add", "-A")
+
+	tree := strings.TrimSpace(runGit(t, "write-tree"))
+
+	diff, err := getStagedChanges("--binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := parseDiff(diff)
+	units := splitUnits(files)
+
+	var hunks []string
+	for _, unit := range units {
+		hunks = append(hunks, files[unit.file].Path)
+	}
+
+	if want := []string{"deleted.txt", "image.bin", "new.txt", "same.txt", "same.txt", "same.txt"}; !slices.Equal(hunks, want) {
+		t.Fatalf("units cover %q, want %q", hunks, want)
+	}
+
+	// Commit the last hunk first, then the first one together with the new files and the middle one last
+	response := `[
+		{"message": "feat: add C", "hunks": [6]},
+		{"message": "feat: add A", "hunks": [4, 2, 3]},
+		{"message": "fix: change B", "hunks": [5, 1]}
+	]`
+
+	commits, err := parseSplitPlan(response, files, units)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head := strings.TrimSpace(runGit(t, "rev-parse", "HEAD"))
+	runGit(t, "read-tree", head)
+
+	// Splitting from a subdirectory still commits the changes outside of it
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	state := &splitState{Head: head, Tree: tree, Commits: commits}
+	if err := state.run(CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.TrimSpace(runGit(t, "rev-parse", "HEAD^{tree}")); got != tree {
+		t.Errorf("tree after splitting = %s, want the staged tree %s", got, tree)
+	}
+
+	// Every intermediate commit contains exactly the hunks of its group, at the right place
+	withC := insertLines(original, 55, "C1")
+	withA := insertLines(withC, 5, added...)
+
+	tests := []struct {
+		rev     string
+		subject string
+		content string
+	}{
+		{"HEAD~2", "feat: add C", joinLines(withC)},
+		{"HEAD~1", "feat: add A", joinLines(withA)},
+		{"HEAD", "fix: change B", joinLines(changed)},
+	}
+
+	for _, tt := range tests {
+		if got := strings.TrimSpace(runGit(t, "log", "-1", "--format=%s", tt.rev)); got != tt.subject {
+			t.Errorf("%s subject = %q, want %q", tt.rev, got, tt.subject)
+		}
+
+		if got := runGit(t, "show", tt.rev+":same.txt"); got != tt.content {
+			t.Errorf("%s:same.txt =\n%s\nwant\n%s", tt.rev, got, tt.content)
+		}
+	}
+
+	if out := runGit(t, "ls-tree", "--full-tree", "--name-only", "HEAD~1"); !strings.Contains(out, "image.bin") || !strings.Contains(out, "new.txt") || !strings.Contains(out, "deleted.txt") {
+		t.Errorf("HEAD~1 should contain the new files and still the deleted one, got %q", out)
+	}
+
+	if state, err := loadSplitState(); err != nil || state != nil {
+		t.Errorf("split state should be removed, got %v, %v", state, err)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/log"
+)
+
+// A file with changes that haven't been staged yet
+type UnstagedFile struct {
+	Path string
+	// The single letter status of the file, eg. `M` for modified or `?` for untracked
+	Status  string
+	Added   int
+	Removed int
+	Binary  bool
+}
+
+func (f UnstagedFile) String() string {
+	if f.Binary {
+		return fmt.Sprintf("%s %s (binary)", f.Status, f.Path)
+	}
+
+	return fmt.Sprintf("%s %s (+%d -%d)", f.Status, f.Path, f.Added, f.Removed)
+}
+
+// Check whether there are any staged changes
+func hasStagedChanges() (bool, error) {
+	err := exec.Command("git", "diff", "--cached", "--quiet").Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return true, nil
+	}
+
+	return false, err
+}
+
+// List the modified and untracked files in the working tree, along with their diff stats.
+// Paths are relative to the root of the repository, wherever convit is run from.
+func getUnstagedFiles() ([]UnstagedFile, error) {
+	root, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := exec.Command("git", "-C", root, "status", "--porcelain=v2", "-z", "--untracked-files=all").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := getUnstagedStats(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []UnstagedFile
+	entries := strings.Split(string(status), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "?":
+			file := UnstagedFile{Path: strings.TrimPrefix(entry, "? "), Status: "?"}
+			file.Added, file.Binary = countLines(filepath.Join(root, file.Path))
+			files = append(files, file)
+		case "1", "2":
+			// Ordinary and renamed entries: `<type> <XY> <sub> <mH> <mI> <mW> <hH> <hI> [<X><score>] <path>`
+			n := 9
+			if fields[0] == "2" {
+				n = 10
+
+				// The original path of a rename is passed as a separate entry
+				i++
+			}
+
+			parts := strings.SplitN(entry, " ", n)
+			if len(parts) < n {
+				continue
+			}
+
+			// Only files with changes in the working tree are of interest
+			worktree := fields[1][1:]
+			if worktree == "." {
+				continue
+			}
+
+			file := stats[parts[n-1]]
+			file.Path = parts[n-1]
+			file.Status = worktree
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+// Get the diff stats of the unstaged changes of tracked files in the repository at root
+func getUnstagedStats(root string) (map[string]UnstagedFile, error) {
+	out, err := exec.Command("git", "-C", root, "diff", "--numstat", "-z").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]UnstagedFile)
+	entries := strings.Split(string(out), "\x00")
+	for i := 0; i < len(entries); i++ {
+		parts := strings.SplitN(entries[i], "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		// Renames have an empty path followed by the original and the new path as separate entries
+		if parts[2] == "" {
+			if i+2 >= len(entries) {
+				break
+			}
+
+			parts[2] = entries[i+2]
+			i += 2
+		}
+
+		var file UnstagedFile
+		if parts[0] == "-" {
+			file.Binary = true
+		} else {
+			file.Added, _ = strconv.Atoi(parts[0])
+			file.Removed, _ = strconv.Atoi(parts[1])
+		}
+
+		stats[parts[2]] = file
+	}
+
+	return stats, nil
+}
+
+// Count the lines of an untracked file, reporting whether it looks like a binary file
+func countLines(path string) (int, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+
+	if bytes.IndexByte(data, 0) != -1 {
+		return 0, true
+	}
+
+	lines := bytes.Count(data, []byte("\n"))
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		lines++
+	}
+
+	return lines, false
+}
+
+// Stage the provided paths, which are relative to the root of the repository
+func stageFiles(paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	args := []string{"add", "--"}
+	for _, path := range paths {
+		args = append(args, ":(top,literal)"+path)
+	}
+
+	_, err := gitOutput(args...)
+
+	return err
+}
+
+// Options that control what gets staged before committing
+type StageOptions struct {
+	// Stage every tracked change, similar to `git commit -a`
+	All bool
+	// Let the user pick individual hunks to stage, similar to `git add -p`
+	Patch bool
+}
+
+// Make sure there is something to commit, staging changes according to the provided options.
+// If nothing is staged the user is asked which of the modified and untracked files should be.
+func (c *Convit) ensureStagedChanges(opts StageOptions) error {
+	if opts.All {
+		if _, err := gitOutput("add", "--update"); err != nil {
+			return err
+		}
+	}
+
+	if opts.Patch {
+		if err := c.pickHunks(); err != nil {
+			return err
+		}
+	}
+
+	staged, err := hasStagedChanges()
+	if err != nil || staged {
+		return err
+	}
+
+	// The user already had the chance to pick what to stage
+	if opts.Patch {
+		return newNoChangesError("no changes selected")
+	}
+
+	files, err := getUnstagedFiles()
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return newNoChangesError("no changes found")
+	}
+
+	options := make([]huh.Option[string], 0, len(files))
+	for _, file := range files {
+		options = append(options, huh.NewOption(file.String(), file.Path))
+	}
+
+	var selected []string
+	if err := huh.NewMultiSelect[string]().
+		Title("Nothing is staged yet, select the files to stage").
+		Options(options...).
+		Filterable(true).
+		Value(&selected).
+		Run(); err != nil {
+		return err
+	}
+
+	if len(selected) == 0 {
+		return newNoChangesError("no files selected")
+	}
+
+	log.Debug("Staging files", "files", selected)
+
+	return stageFiles(selected...)
+}
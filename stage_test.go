@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUnstagedFilesFromSubdirectory(t *testing.T) {
+	dir := testRepo(t)
+
+	if err := os.MkdirAll("sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, "top.txt", "top\n")
+	writeFile(t, "sub/old.txt", strings.Join(numberedLines(20), "\n")+"\n")
+	runGit(t, "add", ".")
+	runGit(t, "commit", "-q", "-m", "chore: initial commit")
+
+	// An unstaged rename shows up once the new path is added with intent to add
+	if err := os.Rename("sub/old.txt", "sub/new.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, "sub/new.txt", strings.Join(numberedLines(21), "\n")+"\n")
+	runGit(t, "add", "-N", "sub/new.txt")
+	writeFile(t, "top.txt", "top\nchanged\n")
+	writeFile(t, "sub/untracked.txt", "one\ntwo\nthree\n")
+
+	if err := os.Chdir(filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := getUnstagedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []UnstagedFile{
+		{Path: "sub/new.txt", Status: "R", Added: 1},
+		{Path: "top.txt", Status: "M", Added: 1},
+		{Path: "sub/untracked.txt", Status: "?", Added: 3},
+	}
+
+	if !slices.Equal(files, want) {
+		t.Fatalf("files = %+v, want %+v", files, want)
+	}
+
+	if err := stageFiles("top.txt", "sub/untracked.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := runGit(t, "diff", "--cached", "--name-status", "--no-renames"); got != "A\tsub/untracked.txt\nM\ttop.txt\n" {
+		t.Errorf("staged = %q", got)
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/charmbracelet/log"
+	"github.com/segersniels/convit/generate"
+)
+
+// The price in USD per million tokens
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// The list prices of the supported models, can be overridden through the configuration
+var DefaultPrices = map[string]Price{
+	GPT4oMini:         {Input: 0.15, Output: 0.60},
+	GPT4o:             {Input: 2.50, Output: 10.00},
+	GPT4Turbo:         {Input: 10.00, Output: 30.00},
+	GPT3Dot5Turbo:     {Input: 0.50, Output: 1.50},
+	Claude3Dot5Sonnet: {Input: 3.00, Output: 15.00},
+	FakeModel:         {},
+}
+
+// Estimate the cost in USD of the usage for the model, zero when the price of the model is unknown
+func usageCost(model string, usage generate.Usage) float64 {
+	price, ok := CONFIG.Data.Prices[model]
+	if !ok {
+		price = DefaultPrices[model]
+	}
+
+	return (float64(usage.InputTokens)*price.Input + float64(usage.OutputTokens)*price.Output) / 1_000_000
+}
+
+// A single request to a provider as recorded in the ledger
+type UsageEntry struct {
+	Time         time.Time `json:"time"`
+	Model        string    `json:"model"`
+	Provider     string    `json:"provider"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	Cost         float64   `json:"cost"`
+	Repository   string    `json:"repository"`
+}
+
+// The path of a file next to the configuration, shared by every repository. The config library doesn't
+// expose where it stores the configuration, so the directory is derived from its name the same way it does.
+func configPath(name string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".config", CONFIG.Name, name), nil
+}
+
+// The ledger lives next to the configuration so it covers every repository
+func usageLedgerPath() (string, error) {
+	return configPath("usage.jsonl")
+}
+
+func appendUsage(entry UsageEntry) error {
+	path, err := usageLedgerPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshaling usage: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+
+	return err
+}
+
+// Read every entry from the ledger, skipping lines that can't be parsed
+func loadUsage() ([]UsageEntry, error) {
+	path, err := usageLedgerPath()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []UsageEntry
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry UsageEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Debug("Skipping invalid usage entry", "error", err)
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// Wraps a client to record the usage of every request in the ledger
+type recordingClient struct {
+	client   MessageClient
+	model    string
+	provider string
+
+	mu    sync.Mutex
+	total generate.Usage
+}
+
+// A recording client for clients that support structured output, so the generator still picks it up
+type recordingStructuredClient struct {
+	*recordingClient
+	structured generate.StructuredClient
+}
+
+func newRecordingClient(client MessageClient, model, provider string) MessageClient {
+	recording := &recordingClient{client: client, model: model, provider: provider}
+	if structured, ok := client.(generate.StructuredClient); ok {
+		return &recordingStructuredClient{recording, structured}
+	}
+
+	return recording
+}
+
+// The fake provider doesn't spend anything, so it is kept out of the ledger and the budget
+func (r *recordingClient) metered() bool {
+	return r.provider != ProviderFake
+}
+
+func (r *recordingClient) enforceBudget(system, prompt string) error {
+	if !r.metered() {
+		return nil
+	}
+
+	return enforceBudget(r.model, system, prompt)
+}
+
+func (r *recordingClient) record(usage generate.Usage) {
+	r.mu.Lock()
+	r.total = r.total.Add(usage)
+	r.mu.Unlock()
+
+	if !r.metered() {
+		return
+	}
+
+	// The repository is only used for reporting, so it is fine to leave it empty outside of one
+	repository, _ := gitOutput("rev-parse", "--show-toplevel")
+
+	err := appendUsage(UsageEntry{
+		Time:         time.Now(),
+		Model:        r.model,
+		Provider:     r.provider,
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		Cost:         usageCost(r.model, usage),
+		Repository:   repository,
+	})
+
+	if err != nil {
+		log.Debug("Failed to record usage", "error", err)
+	}
+}
+
+// The usage of every request made through the client so far
+func (r *recordingClient) usage() generate.Usage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.total
+}
+
+func (r *recordingClient) CreateMessage(ctx context.Context, system string, prompt string) (string, generate.Usage, error) {
+	if err := r.enforceBudget(system, prompt); err != nil {
+		return "", generate.Usage{}, err
+	}
+
+	response, usage, err := r.client.CreateMessage(ctx, system, prompt)
+	if err == nil {
+		r.record(usage)
+	}
+
+	return response, usage, err
+}
+
+func (r *recordingStructuredClient) CreateStructuredMessage(ctx context.Context, system string, prompt string, schema generate.Schema) (string, generate.Usage, error) {
+	if err := r.enforceBudget(system, prompt); err != nil {
+		return "", generate.Usage{}, err
+	}
+
+	response, usage, err := r.structured.CreateStructuredMessage(ctx, system, prompt, schema)
+	if err == nil {
+		r.record(usage)
+	}
+
+	return response, usage, err
+}
+
+// The usage of every request made through the provider so far
+func (p *Provider) usage() generate.Usage {
+	switch client := p.client.(type) {
+	case *recordingClient:
+		return client.usage()
+	case *recordingStructuredClient:
+		return client.usage()
+	}
+
+	return generate.Usage{}
+}
+
+// Print the tokens and estimated cost of a generation
+func printUsage(model string, usage generate.Usage) {
+	log.Info("Generation usage", "input", usage.InputTokens, "output", usage.OutputTokens, "cost", fmt.Sprintf("$%.4f", usageCost(model, usage)))
+}
+
+// Totals of a group of ledger entries
+type usageTotal struct {
+	key      string
+	requests int
+	input    int
+	output   int
+	cost     float64
+}
+
+// Sum the entries per key, sorted by key
+func groupUsage(entries []UsageEntry, key func(UsageEntry) string) []usageTotal {
+	totals := map[string]*usageTotal{}
+	for _, entry := range entries {
+		k := key(entry)
+		if totals[k] == nil {
+			totals[k] = &usageTotal{key: k}
+		}
+
+		totals[k].requests++
+		totals[k].input += entry.InputTokens
+		totals[k].output += entry.OutputTokens
+		totals[k].cost += entry.Cost
+	}
+
+	result := make([]usageTotal, 0, len(totals))
+	for _, total := range totals {
+		result = append(result, *total)
+	}
+
+	slices.SortFunc(result, func(a, b usageTotal) int {
+		switch {
+		case a.key < b.key:
+			return -1
+		case a.key > b.key:
+			return 1
+		}
+
+		return 0
+	})
+
+	return result
+}
+
+// Show repositories by their name, or by their full path when several share the same name
+func repositoryLabels(totals []usageTotal) []usageTotal {
+	names := map[string]int{}
+	for _, total := range totals {
+		names[filepath.Base(total.key)]++
+	}
+
+	labeled := make([]usageTotal, 0, len(totals))
+	for _, total := range totals {
+		switch name := filepath.Base(total.key); {
+		case total.key == "":
+			total.key = "unknown"
+		case names[name] == 1:
+			total.key = name
+		}
+
+		labeled = append(labeled, total)
+	}
+
+	return labeled
+}
+
+// Render the totals as a table, with the overall total as the last row
+func renderUsage(title string, totals []usageTotal) string {
+	cell := lipgloss.NewStyle().Padding(0, 1)
+
+	t := table.New().
+		Border(lipgloss.RoundedBorder()).
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if row == 0 || row == len(totals)+1 {
+				return cell.Bold(true)
+			}
+
+			return cell
+		}).
+		Headers(title, "Requests", "Input tokens", "Output tokens", "Cost")
+
+	var overall usageTotal
+	for _, total := range totals {
+		t.Row(total.key, strconv.Itoa(total.requests), strconv.Itoa(total.input), strconv.Itoa(total.output), fmt.Sprintf("$%.4f", total.cost))
+
+		overall.requests += total.requests
+		overall.input += total.input
+		overall.output += total.output
+		overall.cost += total.cost
+	}
+
+	t.Row("Total", strconv.Itoa(overall.requests), strconv.Itoa(overall.input), strconv.Itoa(overall.output), fmt.Sprintf("$%.4f", overall.cost))
+
+	return t.Render()
+}
+
+// Report the recorded usage of the last days by day, model and repository
+func (c *Convit) Usage(days int) error {
+	entries, err := loadUsage()
+	if err != nil {
+		return err
+	}
+
+	if days > 0 {
+		since := time.Now().AddDate(0, 0, -days)
+		entries = slices.DeleteFunc(entries, func(entry UsageEntry) bool {
+			return entry.Time.Before(since)
+		})
+	}
+
+	if len(entries) == 0 {
+		log.Info("No usage recorded yet")
+		return nil
+	}
+
+	byDay := groupUsage(entries, func(entry UsageEntry) string {
+		return entry.Time.Local().Format(time.DateOnly)
+	})
+
+	byModel := groupUsage(entries, func(entry UsageEntry) string {
+		return entry.Model
+	})
+
+	// Repositories with the same name in different places are kept apart, only their names are shown
+	byRepository := groupUsage(entries, func(entry UsageEntry) string {
+		return entry.Repository
+	})
+
+	fmt.Printf("%s\n%s\n%s\n", renderUsage("Day", byDay), renderUsage("Model", byModel), renderUsage("Repository", repositoryLabels(byRepository)))
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/segersniels/convit/generate"
+)
+
+func TestUsageCost(t *testing.T) {
+	useConfig(t, ConfigData{Prices: map[string]Price{
+		GPT4o:          {Input: 1, Output: 2},
+		"custom-model": {Input: 5, Output: 10},
+	}})
+
+	tests := []struct {
+		model string
+		usage generate.Usage
+		want  float64
+	}{
+		{GPT4oMini, generate.Usage{InputTokens: 1_000_000, OutputTokens: 1_000_000}, 0.75},
+		{Claude3Dot5Sonnet, generate.Usage{InputTokens: 2000, OutputTokens: 100}, 0.0075},
+		// Configured prices take precedence over the built-in ones
+		{GPT4o, generate.Usage{InputTokens: 1_000_000, OutputTokens: 500_000}, 2},
+		{"custom-model", generate.Usage{InputTokens: 100_000}, 0.5},
+		// Unknown models and the fake provider don't cost anything
+		{"unknown-model", generate.Usage{InputTokens: 1_000_000, OutputTokens: 1_000_000}, 0},
+		{FakeModel, generate.Usage{InputTokens: 1_000_000, OutputTokens: 1_000_000}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := usageCost(tt.model, tt.usage); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("usageCost(%s, %+v) = %f, want %f", tt.model, tt.usage, got, tt.want)
+		}
+	}
+}
+
+func TestGroupUsage(t *testing.T) {
+	entries := []UsageEntry{
+		{Model: GPT4oMini, Repository: "/b", InputTokens: 100, OutputTokens: 10, Cost: 0.1},
+		{Model: Claude3Dot5Sonnet, Repository: "/a", InputTokens: 200, OutputTokens: 20, Cost: 0.2},
+		{Model: GPT4oMini, Repository: "/a", InputTokens: 300, OutputTokens: 30, Cost: 0.3},
+	}
+
+	byModel := groupUsage(entries, func(entry UsageEntry) string { return entry.Model })
+	want := []usageTotal{
+		{key: Claude3Dot5Sonnet, requests: 1, input: 200, output: 20, cost: 0.2},
+		{key: GPT4oMini, requests: 2, input: 400, output: 40, cost: 0.1 + 0.3},
+	}
+
+	if !slices.Equal(byModel, want) {
+		t.Errorf("by model = %+v, want %+v", byModel, want)
+	}
+
+	byRepository := groupUsage(entries, func(entry UsageEntry) string { return entry.Repository })
+	if len(byRepository) != 2 || byRepository[0].key != "/a" || byRepository[0].requests != 2 || byRepository[1].key != "/b" {
+		t.Errorf("by repository = %+v", byRepository)
+	}
+
+	if totals := groupUsage(nil, func(entry UsageEntry) string { return entry.Model }); len(totals) != 0 {
+		t.Errorf("totals without entries = %+v", totals)
+	}
+}
+
+func TestRepositoryLabels(t *testing.T) {
+	entries := []UsageEntry{
+		{Repository: "/work/api"},
+		{Repository: "/personal/api"},
+		{Repository: "/work/web"},
+		{Repository: "/work/web"},
+		{Repository: ""},
+	}
+
+	// Repositories sharing a name are grouped apart and shown by their full path
+	totals := repositoryLabels(groupUsage(entries, func(entry UsageEntry) string { return entry.Repository }))
+
+	var labels []string
+	for _, total := range totals {
+		labels = append(labels, total.key)
+	}
+
+	if want := []string{"unknown", "/personal/api", "/work/api", "web"}; !slices.Equal(labels, want) {
+		t.Errorf("labels = %q, want %q", labels, want)
+	}
+
+	if totals[3].requests != 2 {
+		t.Errorf("web requests = %d, want 2", totals[3].requests)
+	}
+}
+
+func TestRecordingClient(t *testing.T) {
+	testHome(t)
+	useConfig(t, ConfigData{})
+
+	fake, err := NewFake(FakeFixtures{Default: "feat: add x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake client stands in for a real provider
+	client := newRecordingClient(fake, GPT4oMini, ProviderOpenAI)
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := client.CreateMessage(context.Background(), "system", "a prompt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := loadUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("recorded %d entries, want 2", len(entries))
+	}
+
+	want := fakeUsage("system", "a prompt", "feat: add x")
+	for _, entry := range entries {
+		if entry.Model != GPT4oMini || entry.Provider != ProviderOpenAI || entry.InputTokens != want.InputTokens || entry.Cost != usageCost(GPT4oMini, want) {
+			t.Errorf("entry = %+v", entry)
+		}
+
+		if time.Since(entry.Time) > time.Minute {
+			t.Errorf("entry time = %s", entry.Time)
+		}
+	}
+
+	if got := client.(*recordingClient).usage(); got != want.Add(want) {
+		t.Errorf("total usage = %+v, want %+v", got, want.Add(want))
+	}
+
+	// Lines that can't be parsed are skipped
+	path, err := usageLedgerPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file.WriteString("not json\n")
+	file.Close()
+
+	if entries, err := loadUsage(); err != nil || len(entries) != 2 {
+		t.Errorf("loadUsage() = %d entries, %v", len(entries), err)
+	}
+}
+
+func TestRecordingClientSkipsFakeProvider(t *testing.T) {
+	testHome(t)
+
+	// Even a request over the budget goes through since the fake provider doesn't spend anything
+	useConfig(t, ConfigData{Budget: Budget{MaxInputTokens: 1, Refuse: true}})
+
+	fake, err := NewFake(FakeFixtures{Default: "feat: add x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newRecordingClient(fake, FakeModel, ProviderFake)
+	if _, _, err := client.CreateMessage(context.Background(), "system", "a prompt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, err := loadUsage(); err != nil || len(entries) != 0 {
+		t.Errorf("loadUsage() = %+v, %v, want no entries", entries, err)
+	}
+
+	// The usage is still tracked for the current command
+	if got := client.(*recordingClient).usage(); got != fakeUsage("system", "a prompt", "feat: add x") {
+		t.Errorf("usage = %+v", got)
+	}
+}
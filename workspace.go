@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+)
+
+// A package of a monorepo along with the directory it lives in, relative to the root of the repository
+type WorkspacePackage struct {
+	Name string
+	Dir  string
+}
+
+var (
+	// Matches `use ./dir` as well as the entries of a `use ( ... )` block
+	goWorkUse = regexp.MustCompile(`^(?:use\s+)?("[^"]+"|[^\s()"]+)$`)
+	// Matches `- packages/*` list items in YAML, with or without quotes
+	yamlListItem = regexp.MustCompile(`^\s*-\s*['"]?([^'"#]+?)['"]?\s*(?:#.*)?$`)
+	// Matches `key = "value"` in TOML
+	tomlString = regexp.MustCompile(`^\s*([\w-]+)\s*=\s*"([^"]*)"`)
+	// Matches the quoted values of a TOML array
+	tomlArrayItem = regexp.MustCompile(`"([^"]*)"`)
+)
+
+// Directories that never contain workspace packages but can be huge
+var skippedDirs = []string{".git", "node_modules", "target", "vendor"}
+
+// Detect the packages of a monorepo from `go.work`, `package.json` workspaces, `pnpm-workspace.yaml`
+// and Cargo workspaces. Returns nothing when the repository isn't a monorepo.
+func detectWorkspace(root string) []WorkspacePackage {
+	var packages []WorkspacePackage
+	for _, detect := range []func(string) []WorkspacePackage{goWorkPackages, npmWorkspacePackages, pnpmWorkspacePackages, cargoWorkspacePackages} {
+		packages = append(packages, detect(root)...)
+	}
+
+	// Check the deepest directories first so nested packages win over the ones containing them
+	slices.SortStableFunc(packages, func(a, b WorkspacePackage) int {
+		return len(b.Dir) - len(a.Dir)
+	})
+
+	return slices.CompactFunc(packages, func(a, b WorkspacePackage) bool {
+		return a.Dir == b.Dir
+	})
+}
+
+// The packages of the current repository, only detected once since it requires walking the repository
+var workspacePackages = sync.OnceValue(func() []WorkspacePackage {
+	root, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil
+	}
+
+	return detectWorkspace(root)
+})
+
+// The package a file belongs to, nil when it isn't part of any
+func packageForFile(packages []WorkspacePackage, file string) *WorkspacePackage {
+	for i, pkg := range packages {
+		if pkg.Dir == "" || file == pkg.Dir || strings.HasPrefix(file, pkg.Dir+"/") {
+			return &packages[i]
+		}
+	}
+
+	return nil
+}
+
+// The names of the packages touched by the files, in order of appearance
+func touchedPackages(packages []WorkspacePackage, files []string) []string {
+	var names []string
+	for _, file := range files {
+		if pkg := packageForFile(packages, file); pkg != nil && !slices.Contains(names, pkg.Name) {
+			names = append(names, pkg.Name)
+		}
+	}
+
+	return names
+}
+
+// The names of all packages, sorted
+func packageNames(packages []WorkspacePackage) []string {
+	names := make([]string, 0, len(packages))
+	for _, pkg := range packages {
+		if !slices.Contains(names, pkg.Name) {
+			names = append(names, pkg.Name)
+		}
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// Warn when the changes span several packages since they are likely better off as separate commits
+func warnAboutPackages(diff string) {
+	touched := touchedPackages(workspacePackages(), diffPaths(diff))
+	if len(touched) > 1 {
+		log.Warn("Your changes touch multiple packages, consider splitting them up with `convit split`", "packages", strings.Join(touched, ", "))
+	}
+}
+
+// Expand workspace globs (eg. `packages/*`) to the directories they match, relative to the root.
+// Patterns starting with `!` exclude directories again.
+func expandWorkspaceGlobs(root string, patterns []string) []string {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	var dirs []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+
+		if slices.Contains(skippedDirs, d.Name()) {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return nil
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		included := false
+		for _, pattern := range patterns {
+			pattern = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(pattern), "./"), "/")
+			if excluded, ok := strings.CutPrefix(pattern, "!"); ok {
+				if matchWorkspaceGlob(strings.TrimPrefix(excluded, "./"), rel) {
+					included = false
+				}
+
+				continue
+			}
+
+			if matchWorkspaceGlob(pattern, rel) {
+				included = true
+			}
+		}
+
+		if included {
+			dirs = append(dirs, rel)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		log.Debug("Failed to expand workspace globs", "error", err)
+	}
+
+	return dirs
+}
+
+// Unlike matchGlob, workspace globs are always matched against the full path
+func matchWorkspaceGlob(pattern, dir string) bool {
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return false
+	}
+
+	return re.MatchString(dir)
+}
+
+// The last element of a Go module path, eg. `api` for `github.com/acme/monorepo/api`
+func goModuleName(root, dir string) string {
+	file, err := os.Open(filepath.Join(root, dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if module, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "module "); ok {
+			return path.Base(strings.Trim(strings.TrimSpace(module), `"`))
+		}
+	}
+
+	return ""
+}
+
+func goWorkPackages(root string) []WorkspacePackage {
+	data, err := os.ReadFile(filepath.Join(root, "go.work"))
+	if err != nil {
+		return nil
+	}
+
+	var (
+		packages []WorkspacePackage
+		inUse    bool
+	)
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "//")
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "use (":
+			inUse = true
+			continue
+		case line == ")":
+			inUse = false
+			continue
+		case !inUse && !strings.HasPrefix(line, "use "):
+			continue
+		}
+
+		match := goWorkUse.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		dir := path.Clean(strings.TrimPrefix(strings.Trim(match[1], `"`), "./"))
+		if dir == "." {
+			dir = ""
+		}
+
+		if name := goModuleName(root, dir); name != "" {
+			packages = append(packages, WorkspacePackage{Name: name, Dir: dir})
+		}
+	}
+
+	return packages
+}
+
+// The name of an npm package without its organisation, eg. `ui` for `@acme/ui`
+func npmPackageName(root, dir string) string {
+	data, err := os.ReadFile(filepath.Join(root, dir, "package.json"))
+	if err != nil {
+		return ""
+	}
+
+	var manifest struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return ""
+	}
+
+	return path.Base(manifest.Name)
+}
+
+func npmPackages(root string, patterns []string) []WorkspacePackage {
+	var packages []WorkspacePackage
+	for _, dir := range expandWorkspaceGlobs(root, patterns) {
+		if name := npmPackageName(root, dir); name != "" {
+			packages = append(packages, WorkspacePackage{Name: name, Dir: dir})
+		}
+	}
+
+	return packages
+}
+
+func npmWorkspacePackages(root string) []WorkspacePackage {
+	data, err := os.ReadFile(filepath.Join(root, "package.json"))
+	if err != nil {
+		return nil
+	}
+
+	var manifest struct {
+		Workspaces json.RawMessage `json:"workspaces"`
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil || len(manifest.Workspaces) == 0 {
+		return nil
+	}
+
+	// Workspaces are either a list of globs or an object with a `packages` list (yarn)
+	var patterns []string
+	if err := json.Unmarshal(manifest.Workspaces, &patterns); err != nil {
+		var workspaces struct {
+			Packages []string `json:"packages"`
+		}
+
+		if err := json.Unmarshal(manifest.Workspaces, &workspaces); err != nil {
+			return nil
+		}
+
+		patterns = workspaces.Packages
+	}
+
+	return npmPackages(root, patterns)
+}
+
+func pnpmWorkspacePackages(root string) []WorkspacePackage {
+	data, err := os.ReadFile(filepath.Join(root, "pnpm-workspace.yaml"))
+	if err != nil {
+		return nil
+	}
+
+	var (
+		patterns   []string
+		inPackages bool
+	)
+
+	for _, line := range strings.Split(string(data), "\n") {
+		switch {
+		case strings.HasPrefix(line, "packages:"):
+			inPackages = true
+		case inPackages && yamlListItem.MatchString(line):
+			patterns = append(patterns, yamlListItem.FindStringSubmatch(line)[1])
+		case strings.TrimSpace(line) != "" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "-"):
+			// Any other top level key ends the list
+			inPackages = false
+		}
+	}
+
+	return npmPackages(root, patterns)
+}
+
+// Find a string value in a table of a TOML file, eg. `name` in `[package]`
+func tomlValue(data, table, key string) string {
+	current := ""
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			current = strings.Trim(line, "[] ")
+			continue
+		}
+
+		if match := tomlString.FindStringSubmatch(line); match != nil && current == table && match[1] == key {
+			return match[2]
+		}
+	}
+
+	return ""
+}
+
+// Find an array of strings in a table of a TOML file, eg. `members` in `[workspace]`. Arrays can span multiple lines.
+func tomlArray(data, table, key string) []string {
+	var (
+		current string
+		values  []string
+		inArray bool
+	)
+
+	for _, line := range strings.Split(data, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+
+		if inArray {
+			for _, match := range tomlArrayItem.FindAllStringSubmatch(line, -1) {
+				values = append(values, match[1])
+			}
+
+			if strings.Contains(line, "]") {
+				return values
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			current = strings.Trim(line, "[] ")
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || current != table || strings.TrimSpace(name) != key {
+			continue
+		}
+
+		for _, match := range tomlArrayItem.FindAllStringSubmatch(value, -1) {
+			values = append(values, match[1])
+		}
+
+		if !strings.Contains(value, "]") {
+			inArray = true
+			continue
+		}
+
+		return values
+	}
+
+	return values
+}
+
+func cargoWorkspacePackages(root string) []WorkspacePackage {
+	data, err := os.ReadFile(filepath.Join(root, "Cargo.toml"))
+	if err != nil {
+		return nil
+	}
+
+	members := tomlArray(string(data), "workspace", "members")
+	for _, excluded := range tomlArray(string(data), "workspace", "exclude") {
+		members = append(members, "!"+excluded)
+	}
+
+	var packages []WorkspacePackage
+	for _, dir := range expandWorkspaceGlobs(root, members) {
+		manifest, err := os.ReadFile(filepath.Join(root, dir, "Cargo.toml"))
+		if err != nil {
+			continue
+		}
+
+		if name := tomlValue(string(manifest), "package", "name"); name != "" {
+			packages = append(packages, WorkspacePackage{Name: name, Dir: dir})
+		}
+	}
+
+	return packages
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Create the files in a temporary directory, returning the directory
+func workspaceTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, content := range files {
+		writeFile(t, filepath.Join(root, name), content)
+	}
+
+	return root
+}
+
+func TestExpandWorkspaceGlobs(t *testing.T) {
+	root := workspaceTree(t, map[string]string{
+		"packages/a/package.json":        "{}",
+		"packages/b/package.json":        "{}",
+		"packages/b/nested/package.json": "{}",
+		"packages/legacy/package.json":   "{}",
+		"apps/web/package.json":          "{}",
+		"node_modules/dep/package.json":  "{}",
+	})
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{"no patterns", nil, nil},
+		{"single level", []string{"packages/*"}, []string{"packages/a", "packages/b", "packages/legacy"}},
+		{"leading ./ and trailing slash", []string{"./packages/*/"}, []string{"packages/a", "packages/b", "packages/legacy"}},
+		{"across directories", []string{"packages/**"}, []string{"packages/a", "packages/b", "packages/b/nested", "packages/legacy"}},
+		{"exclusion", []string{"packages/*", "!packages/legacy"}, []string{"packages/a", "packages/b"}},
+		{"exclusion with ./", []string{"packages/*", "!./packages/b"}, []string{"packages/a", "packages/legacy"}},
+		{"included again after an exclusion", []string{"packages/*", "!packages/*", "packages/a"}, []string{"packages/a"}},
+		{"plain directories", []string{"apps/web", "packages/a"}, []string{"apps/web", "packages/a"}},
+		{"skipped directories", []string{"node_modules/*"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandWorkspaceGlobs(root, tt.patterns); !slices.Equal(got, tt.want) {
+				t.Errorf("expandWorkspaceGlobs(%q) = %q, want %q", tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+const cargoManifest = `[workspace]
+resolver = "2"
+# Every crate but the experiments
+members = [
+    "crates/*", # the libraries
+    "cli",
+]
+exclude = [
+    "crates/experimental",
+]
+
+[workspace.package]
+name = "not-a-package"
+`
+
+func TestTomlArray(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		table string
+		key   string
+		want  []string
+	}{
+		{"single line", "[workspace]\nmembers = [\"a\", \"b\"]\n", "workspace", "members", []string{"a", "b"}},
+		{"multiple lines with comments", cargoManifest, "workspace", "members", []string{"crates/*", "cli"}},
+		{"other key", cargoManifest, "workspace", "exclude", []string{"crates/experimental"}},
+		{"other table", "[package]\nmembers = [\"a\"]\n", "workspace", "members", nil},
+		{"missing", "[workspace]\n", "workspace", "members", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tomlArray(tt.data, tt.table, tt.key); !slices.Equal(got, tt.want) {
+				t.Errorf("tomlArray(%s, %s) = %q, want %q", tt.table, tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTomlValue(t *testing.T) {
+	data := "[workspace.package]\nname = \"shared\"\n\n[package]\nname = \"api\" # the crate\nversion = \"0.1.0\"\n"
+
+	tests := []struct {
+		table string
+		key   string
+		want  string
+	}{
+		{"package", "name", "api"},
+		{"package", "version", "0.1.0"},
+		{"workspace.package", "name", "shared"},
+		{"package", "edition", ""},
+		{"dependencies", "name", ""},
+	}
+
+	for _, tt := range tests {
+		if got := tomlValue(data, tt.table, tt.key); got != tt.want {
+			t.Errorf("tomlValue(%s, %s) = %q, want %q", tt.table, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestWorkspacePackages(t *testing.T) {
+	tests := []struct {
+		name   string
+		detect func(string) []WorkspacePackage
+		files  map[string]string
+		want   []WorkspacePackage
+	}{
+		{
+			name:   "go.work use directives",
+			detect: goWorkPackages,
+			files: map[string]string{
+				"go.work":        "go 1.22\n\nuse ./api // the server\nuse \"./tools\"\n",
+				"api/go.mod":     "module github.com/acme/monorepo/api\n",
+				"tools/go.mod":   "module \"github.com/acme/monorepo/tools\"\n",
+				"ignored/go.mod": "module github.com/acme/monorepo/ignored\n",
+			},
+			want: []WorkspacePackage{{Name: "api", Dir: "api"}, {Name: "tools", Dir: "tools"}},
+		},
+		{
+			name:   "go.work use block",
+			detect: goWorkPackages,
+			files: map[string]string{
+				"go.work":        "go 1.22\n\nuse (\n\t.\n\t./api\n\t// ./old\n\tmissing\n)\n",
+				"go.mod":         "module github.com/acme/monorepo\n",
+				"api/go.mod":     "module github.com/acme/monorepo/api\n",
+				"old/go.mod":     "module github.com/acme/monorepo/old\n",
+				"missing/README": "no module here",
+			},
+			want: []WorkspacePackage{{Name: "monorepo", Dir: ""}, {Name: "api", Dir: "api"}},
+		},
+		{
+			name:   "npm workspaces",
+			detect: npmWorkspacePackages,
+			files: map[string]string{
+				"package.json":                   `{"workspaces": ["packages/*", "!packages/internal"]}`,
+				"packages/ui/package.json":       `{"name": "@acme/ui"}`,
+				"packages/internal/package.json": `{"name": "@acme/internal"}`,
+				"packages/docs/README.md":        "no manifest",
+			},
+			want: []WorkspacePackage{{Name: "ui", Dir: "packages/ui"}},
+		},
+		{
+			name:   "yarn workspaces object",
+			detect: npmWorkspacePackages,
+			files: map[string]string{
+				"package.json":           `{"workspaces": {"packages": ["apps/*"], "nohoist": ["**/react"]}}`,
+				"apps/web/package.json":  `{"name": "web"}`,
+				"apps/docs/package.json": `{"name": "@acme/docs"}`,
+			},
+			want: []WorkspacePackage{{Name: "docs", Dir: "apps/docs"}, {Name: "web", Dir: "apps/web"}},
+		},
+		{
+			name:   "package.json without workspaces",
+			detect: npmWorkspacePackages,
+			files: map[string]string{
+				"package.json":          `{"name": "app"}`,
+				"apps/web/package.json": `{"name": "web"}`,
+			},
+			want: nil,
+		},
+		{
+			name:   "pnpm workspace",
+			detect: pnpmWorkspacePackages,
+			files: map[string]string{
+				"pnpm-workspace.yaml":           "packages:\n  - 'packages/*'\n  - \"apps/web\" # the site\n  - '!packages/private'\ncatalog:\n  - 'tools/*'\n",
+				"packages/ui/package.json":      `{"name": "@acme/ui"}`,
+				"packages/private/package.json": `{"name": "private"}`,
+				"apps/web/package.json":         `{"name": "web"}`,
+				"tools/lint/package.json":       `{"name": "lint"}`,
+			},
+			want: []WorkspacePackage{{Name: "web", Dir: "apps/web"}, {Name: "ui", Dir: "packages/ui"}},
+		},
+		{
+			name:   "cargo workspace",
+			detect: cargoWorkspacePackages,
+			files: map[string]string{
+				"Cargo.toml":                     cargoManifest,
+				"cli/Cargo.toml":                 "[package]\nname = \"acme-cli\"\n",
+				"crates/core/Cargo.toml":         "[package]\nname = \"acme-core\"\n\n[dependencies]\nname = \"not-the-name\"\n",
+				"crates/experimental/Cargo.toml": "[package]\nname = \"experimental\"\n",
+				"crates/notes/README.md":         "no manifest",
+			},
+			want: []WorkspacePackage{{Name: "acme-cli", Dir: "cli"}, {Name: "acme-core", Dir: "crates/core"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := workspaceTree(t, tt.files)
+
+			if got := tt.detect(root); !slices.Equal(got, tt.want) {
+				t.Errorf("packages = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectWorkspaceNestedPackages(t *testing.T) {
+	root := workspaceTree(t, map[string]string{
+		"go.work":                      "use (\n\t.\n\t./services/api\n)\n",
+		"go.mod":                       "module github.com/acme/monorepo\n",
+		"services/api/go.mod":          "module github.com/acme/monorepo/services/api\n",
+		"package.json":                 `{"workspaces": ["web", "web/packages/*"]}`,
+		"web/package.json":             `{"name": "web"}`,
+		"web/packages/ui/package.json": `{"name": "@acme/ui"}`,
+	})
+
+	packages := detectWorkspace(root)
+
+	want := []WorkspacePackage{
+		{Name: "ui", Dir: "web/packages/ui"},
+		{Name: "api", Dir: "services/api"},
+		{Name: "web", Dir: "web"},
+		{Name: "monorepo", Dir: ""},
+	}
+
+	if !slices.Equal(packages, want) {
+		t.Fatalf("packages = %+v, want %+v", packages, want)
+	}
+
+	// Files belong to the deepest package containing them
+	tests := map[string]string{
+		"web/packages/ui/button.tsx": "ui",
+		"web/index.ts":               "web",
+		"services/api/main.go":       "api",
+		"services/worker/main.go":    "monorepo",
+		"README.md":                  "monorepo",
+	}
+
+	for file, want := range tests {
+		if pkg := packageForFile(packages, file); pkg == nil || pkg.Name != want {
+			t.Errorf("packageForFile(%s) = %+v, want %s", file, pkg, want)
+		}
+	}
+
+	if got := touchedPackages(packages, []string{"web/index.ts", "web/packages/ui/button.tsx", "web/app.ts"}); !slices.Equal(got, []string{"web", "ui"}) {
+		t.Errorf("touched packages = %q", got)
+	}
+}